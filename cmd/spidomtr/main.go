@@ -0,0 +1,171 @@
+// Command spidomtr runs ad-hoc HTTP load tests, e.g.
+//
+//	spidomtr -n 1000 -c 50 -m POST -d @body.json https://example.com/api
+//
+// and prints the same summary as a spidomtr runner. Results saved as
+// JSON can be rendered, merged and compared with a baseline:
+//
+//	spidomtr report -o html result.json > report.html
+//	spidomtr merge -o result.json a.json b.json
+//	spidomtr compare baseline.json result.json
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/handlers"
+	"github.com/spider-pigs/spidomtr/pkg/httpunit"
+)
+
+const usage = `Usage: spidomtr [options] <url>
+       spidomtr report [options] <result.json>
+       spidomtr merge [options] <result.json>...
+       spidomtr compare [options] <baseline.json> <current.json>
+
+Options:
+`
+
+// headers collects repeated -H flags
+type headers [][2]string
+
+func (h *headers) String() string {
+	return fmt.Sprint(*h)
+}
+
+func (h *headers) Set(s string) error {
+	key, value, ok := strings.Cut(s, ":")
+	if !ok {
+		return fmt.Errorf("invalid header %q, expected \"Key: Value\"", s)
+	}
+	*h = append(*h, [2]string{strings.TrimSpace(key), strings.TrimSpace(value)})
+	return nil
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command with args, and returns the exit code
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "report":
+			return report(args[1:], stdout, stderr)
+		case "merge":
+			return merge(args[1:], stdout, stderr)
+		case "compare":
+			return compare(args[1:], stdout, stderr)
+		}
+	}
+
+	fs := flag.NewFlagSet("spidomtr", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+
+	var hs headers
+	n := fs.Int("n", 200, "number of requests to run")
+	c := fs.Int("c", 50, "number of concurrent users")
+	method := fs.String("m", "GET", "HTTP method")
+	data := fs.String("d", "", "request body, or @file to read it from a file")
+	fs.Var(&hs, "H", "request header as \"Key: Value\", may be repeated")
+	timeout := fs.Duration("t", 20*time.Second, "request timeout")
+	rate := fs.Float64("q", 0, "rate limit in requests per second across all users (0 for no limit)")
+	duration := fs.Duration("z", 0, "run for a duration, e.g. 10s, instead of a number of requests")
+	output := fs.String("o", "text", "output format: text, json or csv")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	url := fs.Arg(0)
+	if *c < 1 || *n < 1 {
+		fmt.Fprintln(stderr, "spidomtr: -n and -c must be at least 1")
+		return 2
+	}
+
+	opts := []httpunit.Option{
+		httpunit.MaxIdleConnsPerHost(*c),
+	}
+	if *data != "" {
+		body, err := readData(*data)
+		if err != nil {
+			fmt.Fprintf(stderr, "spidomtr: %v\n", err)
+			return 1
+		}
+		opts = append(opts, httpunit.Body(body))
+	}
+	for _, h := range hs {
+		opts = append(opts, httpunit.Header(h[0], h[1]))
+	}
+	test := httpunit.New(*method, url, opts...)
+
+	options := []spidomtr.Option{
+		spidomtr.ID(*method + " " + url),
+		spidomtr.Output(stdout),
+		spidomtr.Rate(*rate),
+		spidomtr.Timeout(*timeout),
+		spidomtr.TotalIterations(*n),
+		spidomtr.Users(*c),
+	}
+	if *duration > 0 {
+		options = append(options, spidomtr.Duration(*duration))
+	}
+
+	switch *output {
+	case "text":
+	case "json":
+		options = append(options, spidomtr.ShowLogo(false), spidomtr.ShowSummary(false))
+	case "csv":
+		options = append(options,
+			spidomtr.Handlers(handlers.CSV(stdout)),
+			spidomtr.ShowLogo(false),
+			spidomtr.ShowSummary(false),
+		)
+	default:
+		fmt.Fprintf(stderr, "spidomtr: unknown output format %q\n", *output)
+		return 2
+	}
+
+	res := spidomtr.NewRunner(options...).Run(ctx, test)
+
+	if *output == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res); err != nil {
+			fmt.Fprintf(stderr, "spidomtr: %v\n", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// readData returns data, or the contents of the file if data is @file
+func readData(data string) ([]byte, error) {
+	name, ok := strings.CutPrefix(data, "@")
+	if !ok {
+		return []byte(data), nil
+	}
+	b, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("body file %s not found", name)
+	}
+	return b, err
+}
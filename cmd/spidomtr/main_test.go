@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	mu      sync.Mutex
+	bodies  []string
+	headers []http.Header
+	methods []string
+}
+
+func server(t *testing.T, rec *recorder) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		rec.mu.Lock()
+		rec.bodies = append(rec.bodies, string(b))
+		rec.headers = append(rec.headers, r.Header)
+		rec.methods = append(rec.methods, r.Method)
+		rec.mu.Unlock()
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRunText(t *testing.T) {
+	rec := &recorder{}
+	srv := server(t, rec)
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"-n", "10", "-c", "3", srv.URL}, &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+	require.Len(t, rec.methods, 10)
+	require.Contains(t, stdout.String(), "Summary:")
+	require.Contains(t, stdout.String(), "OK:        10")
+
+	// Fewer requests than users
+	rec.methods = nil
+	stdout.Reset()
+	code = run(context.Background(), []string{"-n", "2", "-c", "3", srv.URL}, &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+	require.Len(t, rec.methods, 2)
+}
+
+func TestRunJSON(t *testing.T) {
+	rec := &recorder{}
+	srv := server(t, rec)
+
+	body := filepath.Join(t.TempDir(), "body.json")
+	require.NoError(t, os.WriteFile(body, []byte(`{"name":"spider pig"}`), 0o644))
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{
+		"-n", "5", "-c", "2", "-m", "POST", "-d", "@" + body,
+		"-H", "Content-Type: application/json", "-H", "X-Spider: pig",
+		"-o", "json", srv.URL + "/fail",
+	}, &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+
+	var res spidomtr.Result
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &res))
+	require.Equal(t, 5, res.Stats.Count)
+	require.Equal(t, 5, res.Stats.Errors)
+	require.Nil(t, res.ChildResults)
+	require.NotContains(t, stdout.String(), `"ChildResults": [`)
+	results := res.TestStats["POST "+srv.URL+"/fail"].TestResults
+	require.Len(t, results, 5)
+	require.Error(t, results[0].Error)
+
+	require.Equal(t, []string{"POST", "POST", "POST", "POST", "POST"}, rec.methods)
+	for i := range rec.bodies {
+		require.Equal(t, `{"name":"spider pig"}`, rec.bodies[i])
+		require.Equal(t, "application/json", rec.headers[i].Get("Content-Type"))
+		require.Equal(t, "pig", rec.headers[i].Get("X-Spider"))
+	}
+}
+
+func TestRunCSV(t *testing.T) {
+	srv := server(t, &recorder{})
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"-n", "5", "-c", "1", "-o", "csv", srv.URL}, &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+
+	rows, err := csv.NewReader(&stdout).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 6)
+	require.Equal(t, "timestamp", rows[0][0])
+}
+
+func TestRunUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"-n", "0", "http://localhost"},
+		{"-o", "xml", "http://localhost"},
+		{"-H", "nocolon", "http://localhost"},
+		{"-bogus", "http://localhost"},
+	} {
+		var stdout, stderr bytes.Buffer
+		require.Equal(t, 2, run(context.Background(), args, &stdout, &stderr), strings.Join(args, " "))
+		require.NotEmpty(t, stderr.String())
+	}
+
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 1, run(context.Background(), []string{"-d", "@missing.json", "http://localhost"}, &stdout, &stderr))
+	require.Equal(t, "spidomtr: body file missing.json not found\n", stderr.String())
+}
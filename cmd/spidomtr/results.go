@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spider-pigs/spidomtr"
+)
+
+// percentiles collects a comma separated list of percentiles
+type percentiles []int
+
+func (p *percentiles) String() string {
+	return fmt.Sprint(*p)
+}
+
+func (p *percentiles) Set(s string) error {
+	*p = nil
+	for _, f := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || n < 1 || n > 100 {
+			return fmt.Errorf("invalid percentile %q", f)
+		}
+		*p = append(*p, n)
+	}
+	return nil
+}
+
+func newFlagSet(name, usage string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("spidomtr "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// report renders a saved result as a text summary or HTML
+func report(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("report", "Usage: spidomtr report [options] <result.json>\n\nOptions:\n", stderr)
+	output := fs.String("o", "text", "output format: text or html")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	if *output != "text" && *output != "html" {
+		fmt.Fprintf(stderr, "spidomtr: unknown output format %q\n", *output)
+		return 2
+	}
+
+	res, err := readResult(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "spidomtr: %v\n", err)
+		return 1
+	}
+	if *output == "html" {
+		err = spidomtr.WriteHTML(stdout, res)
+	} else {
+		spidomtr.WriteSummary(stdout, res)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "spidomtr: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// merge joins saved results, e.g. from runs on multiple machines, and
+// writes the combined result as JSON
+func merge(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("merge", "Usage: spidomtr merge [options] <result.json>...\n\nOptions:\n", stderr)
+	output := fs.String("o", "", "file to write the merged result to (defaults to stdout)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 2
+	}
+
+	results := make([]spidomtr.Result, 0, fs.NArg())
+	for _, name := range fs.Args() {
+		res, err := readResult(name)
+		if err != nil {
+			fmt.Fprintf(stderr, "spidomtr: %v\n", err)
+			return 1
+		}
+		results = append(results, res)
+	}
+
+	// Keep the resolution of the first result
+	buckets, ps := results[0].Resolution()
+	res := spidomtr.JoinResults(buckets, ps, results...)
+
+	w := stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(stderr, "spidomtr: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(res); err != nil {
+		fmt.Fprintf(stderr, "spidomtr: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// compare compares a saved result with a baseline, and exits with 1 if
+// it regressed
+func compare(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("compare", "Usage: spidomtr compare [options] <baseline.json> <current.json>\n\nOptions:\n", stderr)
+	var opts spidomtr.CompareOptions
+	fs.Float64Var(&opts.Alpha, "alpha", 0.05, "significance level of the latency test")
+	fs.Float64Var(&opts.Tolerance, "tolerance", 0.05, "relative increase in median latency flagged as a regression")
+	fs.Float64Var(&opts.ErrorRateTolerance, "error-rate-tolerance", 0.01, "increase in error rate flagged as a regression")
+	ps := percentiles{50, 90, 99}
+	fs.Var(&ps, "p", "comma separated latency percentiles to compare")
+	output := fs.String("o", "text", "output format: text or markdown")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+	if *output != "text" && *output != "markdown" {
+		fmt.Fprintf(stderr, "spidomtr: unknown output format %q\n", *output)
+		return 2
+	}
+	opts.Percentiles = ps
+
+	baseline, err := readResult(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "spidomtr: %v\n", err)
+		return 1
+	}
+	current, err := readResult(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(stderr, "spidomtr: %v\n", err)
+		return 1
+	}
+
+	c := spidomtr.Compare(baseline, current, opts)
+	if *output == "markdown" {
+		err = c.WriteMarkdown(stdout)
+	} else {
+		err = c.WriteText(stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "spidomtr: %v\n", err)
+		return 1
+	}
+	if c.Regressed() {
+		return 1
+	}
+	return 0
+}
+
+// readResult reads a result saved as JSON, either by -o json or
+// merge, or as a run by the store package
+func readResult(name string) (spidomtr.Result, error) {
+	b, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return spidomtr.Result{}, fmt.Errorf("result file %s not found", name)
+	}
+	if err != nil {
+		return spidomtr.Result{}, err
+	}
+
+	var run struct {
+		Metadata json.RawMessage
+		Result   *spidomtr.Result
+	}
+	if err := json.Unmarshal(b, &run); err != nil {
+		return spidomtr.Result{}, fmt.Errorf("%s: %v", name, err)
+	}
+	if run.Metadata != nil && run.Result != nil {
+		return *run.Result, nil
+	}
+
+	var res spidomtr.Result
+	if err := json.Unmarshal(b, &res); err != nil {
+		return spidomtr.Result{}, fmt.Errorf("%s: %v", name, err)
+	}
+	if res.Stats.Start.IsZero() {
+		return spidomtr.Result{}, fmt.Errorf("%s: not a spidomtr result", name)
+	}
+	return res, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/store"
+	"github.com/stretchr/testify/require"
+)
+
+// saveResult runs n requests to url and saves the result as JSON
+func saveResult(t *testing.T, n int, url string) string {
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"-n", strconv.Itoa(n), "-c", "1", "-o", "json", url}, &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+
+	name := filepath.Join(t.TempDir(), "result.json")
+	require.NoError(t, os.WriteFile(name, stdout.Bytes(), 0o644))
+	return name
+}
+
+func TestReport(t *testing.T) {
+	srv := server(t, &recorder{})
+	name := saveResult(t, 1, srv.URL)
+
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 0, report([]string{name}, &stdout, &stderr), stderr.String())
+	require.Contains(t, stdout.String(), "Summary:")
+	require.Contains(t, stdout.String(), "OK:        1")
+
+	stdout.Reset()
+	require.Equal(t, 0, run(context.Background(), []string{"report", "-o", "html", name}, &stdout, &stderr), stderr.String())
+	require.Contains(t, stdout.String(), "<h2>Tests</h2>")
+	require.Contains(t, stdout.String(), "GET "+srv.URL)
+
+	// Runs saved by the store package
+	res, err := readResult(name)
+	require.NoError(t, err)
+	b, err := json.Marshal(store.Run{Metadata: store.Metadata{ID: "1", RunnerID: "api"}, Result: res})
+	require.NoError(t, err)
+	runName := filepath.Join(t.TempDir(), "run.json")
+	require.NoError(t, os.WriteFile(runName, b, 0o644))
+
+	stdout.Reset()
+	require.Equal(t, 0, report([]string{runName}, &stdout, &stderr), stderr.String())
+	require.Contains(t, stdout.String(), "OK:        1")
+}
+
+func TestMerge(t *testing.T) {
+	srv := server(t, &recorder{})
+	a := saveResult(t, 1, srv.URL)
+	b := saveResult(t, 2, srv.URL+"/fail")
+
+	out := filepath.Join(t.TempDir(), "merged.json")
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 0, run(context.Background(), []string{"merge", "-o", out, a, b}, &stdout, &stderr), stderr.String())
+
+	res, err := readResult(out)
+	require.NoError(t, err)
+	require.Equal(t, 3, res.Stats.Count)
+	require.Equal(t, 1, res.Stats.Passed)
+	require.Equal(t, 2, res.Stats.Errors)
+	require.Len(t, res.TestStats, 2)
+	require.Len(t, res.Stats.Distributions, len(spidomtr.DefaultPercentiles))
+	require.Nil(t, res.ChildResults)
+
+	stdout.Reset()
+	require.Equal(t, 0, merge([]string{a, a}, &stdout, &stderr), stderr.String())
+	var res2 spidomtr.Result
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &res2))
+	require.Equal(t, 2, res2.Stats.Count)
+	require.Len(t, res2.TestStats["GET "+srv.URL].TestResults, 2)
+}
+
+func TestCompare(t *testing.T) {
+	srv := server(t, &recorder{})
+	ok := saveResult(t, 2, srv.URL)
+	fail := saveResult(t, 2, srv.URL+"/fail")
+
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 0, compare([]string{ok, ok}, &stdout, &stderr), stderr.String())
+	require.Contains(t, stdout.String(), "total: ")
+
+	// Error rate increased from 0% to 100%
+	stdout.Reset()
+	require.Equal(t, 1, run(context.Background(), []string{"compare", "-o", "markdown", ok, fail}, &stdout, &stderr))
+	require.Contains(t, stdout.String(), "| Test | Metric |")
+	require.Contains(t, stdout.String(), "REGRESSION**")
+
+	stdout.Reset()
+	require.Equal(t, 0, compare([]string{"-error-rate-tolerance", "1", ok, fail}, &stdout, &stderr), stderr.String())
+}
+
+func TestResultsUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{"report"},
+		{"report", "-o", "pdf", "result.json"},
+		{"merge"},
+		{"compare", "result.json"},
+		{"compare", "-p", "50,101", "a.json", "b.json"},
+	} {
+		var stdout, stderr bytes.Buffer
+		require.Equal(t, 2, run(context.Background(), args, &stdout, &stderr), strings.Join(args, " "))
+		require.NotEmpty(t, stderr.String())
+	}
+
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 1, run(context.Background(), []string{"report", "missing.json"}, &stdout, &stderr))
+	require.Equal(t, "spidomtr: result file missing.json not found\n", stderr.String())
+
+	name := filepath.Join(t.TempDir(), "other.json")
+	require.NoError(t, os.WriteFile(name, []byte(`{"name": "spider pig"}`), 0o644))
+	stderr.Reset()
+	require.Equal(t, 1, run(context.Background(), []string{"report", name}, &stdout, &stderr))
+	require.Equal(t, "spidomtr: "+name+": not a spidomtr result\n", stderr.String())
+}
@@ -0,0 +1,330 @@
+package spidomtr
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// CompareOptions type
+type CompareOptions struct {
+	// Alpha is the significance level of the latency test (defaults to
+	// 0.05)
+	Alpha float64
+	// ErrorRateTolerance is the increase in error rate, e.g. 0.01 for
+	// one percentage point, flagged as a regression (defaults to 0.01)
+	ErrorRateTolerance float64
+	// Percentiles are the latency percentiles compared (defaults to 50,
+	// 90 and 99)
+	Percentiles []int
+	// Tolerance is the relative increase in median latency, e.g. 0.05
+	// for 5%, a significant change must exceed to be flagged as a
+	// regression (defaults to 0.05)
+	Tolerance float64
+}
+
+// Comparison is the comparison of a result with a baseline
+type Comparison struct {
+	Alpha float64
+	Tests []TestComparison
+	Total TestComparison
+}
+
+// TestComparison is the comparison of the stats of a test with a
+// baseline. Latency metrics are in nanoseconds.
+type TestComparison struct {
+	Baseline    bool
+	Current     bool
+	ID          string
+	Metrics     []MetricDiff
+	PValue      float64
+	Regression  bool
+	Significant bool
+}
+
+// MetricDiff is the difference of a metric between a baseline and a
+// current result. Change is the relative change, which is NaN if the
+// baseline value is 0.
+type MetricDiff struct {
+	Baseline float64
+	Change   float64
+	Current  float64
+	Name     string
+}
+
+// Compare compares current with baseline, test by test and in total.
+// Latency changes are tested for significance with a Mann-Whitney U
+// test on the durations of the passed tests, and a test regressed if
+// its median latency increased significantly by more than the
+// tolerance, or its error rate increased by more than the error rate
+// tolerance.
+func Compare(baseline, current Result, opts CompareOptions) Comparison {
+	if opts.Alpha <= 0 {
+		opts.Alpha = 0.05
+	}
+	if opts.ErrorRateTolerance <= 0 {
+		opts.ErrorRateTolerance = 0.01
+	}
+	if len(opts.Percentiles) == 0 {
+		opts.Percentiles = []int{50, 90, 99}
+	}
+	if opts.Tolerance <= 0 {
+		opts.Tolerance = 0.05
+	}
+
+	ids := make([]string, 0, len(current.TestStats))
+	for id := range current.TestStats {
+		ids = append(ids, id)
+	}
+	for id := range baseline.TestStats {
+		if _, ok := current.TestStats[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	c := Comparison{
+		Alpha: opts.Alpha,
+		Total: compareStats("total", &baseline.Stats, &current.Stats, opts),
+	}
+	for _, id := range ids {
+		var b, cur *Stats
+		if ts, ok := baseline.TestStats[id]; ok {
+			b = &ts.Stats
+		}
+		if ts, ok := current.TestStats[id]; ok {
+			cur = &ts.Stats
+		}
+		c.Tests = append(c.Tests, compareStats(id, b, cur, opts))
+	}
+	return c
+}
+
+// Regressed returns if the total or any test regressed
+func (c Comparison) Regressed() bool {
+	if c.Total.Regression {
+		return true
+	}
+	for _, t := range c.Tests {
+		if t.Regression {
+			return true
+		}
+	}
+	return false
+}
+
+// Metric returns the diff of the named metric, e.g. "p99"
+func (t TestComparison) Metric(name string) (MetricDiff, bool) {
+	for _, m := range t.Metrics {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return MetricDiff{}, false
+}
+
+func compareStats(id string, baseline, current *Stats, opts CompareOptions) TestComparison {
+	t := TestComparison{
+		Baseline: baseline != nil,
+		Current:  current != nil,
+		ID:       id,
+		PValue:   math.NaN(),
+	}
+	if baseline == nil || current == nil {
+		return t
+	}
+
+	diff := func(name string, b, c float64) MetricDiff {
+		change := math.NaN()
+		if b != 0 {
+			change = (c - b) / b
+		}
+		return MetricDiff{Baseline: b, Change: change, Current: c, Name: name}
+	}
+
+	t.Metrics = append(t.Metrics,
+		diff("count", float64(baseline.Count), float64(current.Count)),
+		diff("error_rate", metricValue(*baseline, "error_rate"), metricValue(*current, "error_rate")),
+		diff("mean", meanDuration(baseline.Durations), meanDuration(current.Durations)),
+	)
+	for _, p := range opts.Percentiles {
+		name := "p" + strconv.Itoa(p)
+		t.Metrics = append(t.Metrics, diff(name, metricValue(*baseline, name), metricValue(*current, name)))
+	}
+
+	t.PValue = mannWhitney(baseline.Durations, current.Durations)
+	t.Significant = t.PValue < opts.Alpha
+
+	b50, c50 := float64(percentile(baseline.Durations, 50)), float64(percentile(current.Durations, 50))
+	errRate, _ := t.Metric("error_rate")
+	t.Regression = (t.Significant && c50 > b50*(1+opts.Tolerance)) ||
+		errRate.Current-errRate.Baseline > opts.ErrorRateTolerance
+	return t
+}
+
+func meanDuration(durations []time.Duration) float64 {
+	if len(durations) == 0 {
+		return 0
+	}
+	var acc float64
+	for _, d := range durations {
+		acc += float64(d)
+	}
+	return acc / float64(len(durations))
+}
+
+// mannWhitney returns the two-sided p-value of a Mann-Whitney U test of
+// a and b, using the normal approximation with tie correction. It
+// returns NaN if either sample is empty.
+func mannWhitney(a, b []time.Duration) float64 {
+	n1, n2 := len(a), len(b)
+	if n1 == 0 || n2 == 0 {
+		return math.NaN()
+	}
+
+	type sample struct {
+		d     time.Duration
+		first bool
+	}
+	all := make([]sample, 0, n1+n2)
+	for _, d := range a {
+		all = append(all, sample{d, true})
+	}
+	for _, d := range b {
+		all = append(all, sample{d, false})
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].d < all[j].d
+	})
+
+	// Rank the samples, with ties given their average rank
+	var r1, ties float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].d == all[i].d {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].first {
+				r1 += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+
+	n := float64(n1 + n2)
+	u := r1 - float64(n1)*float64(n1+1)/2
+	mu := float64(n1) * float64(n2) / 2
+	sigma := math.Sqrt(float64(n1) * float64(n2) / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+
+	// Continuity correction
+	z := math.Max(math.Abs(u-mu)-0.5, 0) / sigma
+	return math.Erfc(z / math.Sqrt2)
+}
+
+// WriteText writes the comparison as a plain text table, followed by
+// the verdict of each test
+func (c Comparison) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "Test\tMetric\tBaseline\tCurrent\tChange\t\n")
+	for _, t := range c.all() {
+		if !t.Baseline || !t.Current {
+			fmt.Fprintf(tw, "%s\t%s\t\t\t\t\n", t.ID, presence(t))
+			continue
+		}
+		for _, m := range t.Metrics {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t\n", t.ID, m.Name, formatDiffValue(m.Name, m.Baseline), formatDiffValue(m.Name, m.Current), formatChange(m.Change))
+		}
+	}
+	fmt.Fprint(tw, "\n")
+	for _, t := range c.all() {
+		if t.Baseline && t.Current {
+			fmt.Fprintf(tw, "%s: %s\n", t.ID, verdict(t, c.Alpha))
+		}
+	}
+	return tw.Flush()
+}
+
+// WriteMarkdown writes the comparison as a Markdown table, followed by
+// a list of the verdict of each test
+func (c Comparison) WriteMarkdown(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("| Test | Metric | Baseline | Current | Change |\n")
+	sb.WriteString("|---|---|---:|---:|---:|\n")
+	for _, t := range c.all() {
+		id := strings.ReplaceAll(t.ID, "|", "\\|")
+		if !t.Baseline || !t.Current {
+			fmt.Fprintf(&sb, "| %s | %s | | | |\n", id, presence(t))
+			continue
+		}
+		for _, m := range t.Metrics {
+			fmt.Fprintf(&sb, "| %s | %s | %s | %s | %s |\n", id, m.Name, formatDiffValue(m.Name, m.Baseline), formatDiffValue(m.Name, m.Current), formatChange(m.Change))
+		}
+	}
+	sb.WriteString("\n")
+	for _, t := range c.all() {
+		if !t.Baseline || !t.Current {
+			continue
+		}
+		v := verdict(t, c.Alpha)
+		if t.Regression {
+			v = "**" + v + "**"
+		}
+		fmt.Fprintf(&sb, "- `%s`: %s\n", t.ID, v)
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func (c Comparison) all() []TestComparison {
+	return append([]TestComparison{c.Total}, c.Tests...)
+}
+
+func presence(t TestComparison) string {
+	if t.Baseline {
+		return "only in baseline"
+	}
+	return "only in current"
+}
+
+func verdict(t TestComparison, alpha float64) string {
+	s := "no latency samples"
+	if !math.IsNaN(t.PValue) {
+		s = fmt.Sprintf("p=%.3f", t.PValue)
+		if t.Significant {
+			s += fmt.Sprintf(" < %g, significant", alpha)
+		}
+	}
+	if t.Regression {
+		s += ", REGRESSION"
+	}
+	return s
+}
+
+func formatDiffValue(metric string, v float64) string {
+	switch {
+	case metric == "mean" || isLatencyMetric(metric):
+		return msStr(time.Duration(v))
+	case metric == "error_rate":
+		return strconv.FormatFloat(v*100, 'f', 2, 64) + "%"
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func formatChange(change float64) string {
+	if math.IsNaN(change) {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.2f%%", change*100)
+}
@@ -0,0 +1,129 @@
+package spidomtr_test
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/stretchr/testify/require"
+)
+
+func resultOf(tests map[string][]time.Duration, errors int) spidomtr.Result {
+	res := spidomtr.Result{TestStats: make(map[string]spidomtr.TestStats)}
+	for id, durations := range tests {
+		stats := spidomtr.Stats{
+			Count:     len(durations) + errors,
+			Durations: durations,
+			Errors:    errors,
+			Passed:    len(durations),
+		}
+		res.TestStats[id] = spidomtr.TestStats{Stats: stats}
+		res.Stats.Count += stats.Count
+		res.Stats.Errors += stats.Errors
+		res.Stats.Passed += stats.Passed
+		res.Stats.Durations = append(res.Stats.Durations, durations...)
+	}
+	sort.Slice(res.Stats.Durations, func(i, j int) bool {
+		return res.Stats.Durations[i] < res.Stats.Durations[j]
+	})
+	return res
+}
+
+func millis(from, to int) []time.Duration {
+	var ds []time.Duration
+	for i := from; i <= to; i++ {
+		ds = append(ds, time.Duration(i)*time.Millisecond)
+	}
+	return ds
+}
+
+func TestCompare(t *testing.T) {
+	baseline := resultOf(map[string][]time.Duration{
+		"same":    millis(1, 10),
+		"slower":  millis(1, 10),
+		"removed": millis(1, 10),
+	}, 0)
+	current := resultOf(map[string][]time.Duration{
+		"same":   millis(1, 10),
+		"slower": millis(11, 20),
+		"added":  millis(1, 10),
+	}, 0)
+
+	c := spidomtr.Compare(baseline, current, spidomtr.CompareOptions{})
+	require.True(t, c.Regressed())
+
+	ids := make([]string, len(c.Tests))
+	for i, tc := range c.Tests {
+		ids[i] = tc.ID
+	}
+	require.Equal(t, []string{"added", "removed", "same", "slower"}, ids)
+
+	added, removed, same, slower := c.Tests[0], c.Tests[1], c.Tests[2], c.Tests[3]
+	require.False(t, added.Baseline)
+	require.True(t, added.Current)
+	require.True(t, removed.Baseline)
+	require.False(t, removed.Current)
+	require.True(t, math.IsNaN(added.PValue))
+
+	require.False(t, same.Significant)
+	require.False(t, same.Regression)
+	require.InDelta(t, 1, same.PValue, 1e-9)
+
+	require.True(t, slower.Significant)
+	require.True(t, slower.Regression)
+	require.InDelta(t, 0.000183, slower.PValue, 1e-6)
+	mean, ok := slower.Metric("mean")
+	require.True(t, ok)
+	require.Equal(t, float64(5500*time.Microsecond), mean.Baseline)
+	require.Equal(t, float64(15500*time.Microsecond), mean.Current)
+	require.InDelta(t, 1.818, mean.Change, 1e-3)
+	p99, ok := slower.Metric("p99")
+	require.True(t, ok)
+	require.Equal(t, float64(20*time.Millisecond), p99.Current)
+
+	// Faster is not a regression
+	c = spidomtr.Compare(current, baseline, spidomtr.CompareOptions{})
+	require.False(t, c.Regressed())
+
+	// Tolerance ignores small significant changes
+	c = spidomtr.Compare(baseline, current, spidomtr.CompareOptions{Tolerance: 10})
+	require.False(t, c.Regressed())
+}
+
+func TestCompareErrorRate(t *testing.T) {
+	baseline := resultOf(map[string][]time.Duration{"test": millis(1, 90)}, 10)
+	current := resultOf(map[string][]time.Duration{"test": millis(1, 80)}, 20)
+
+	c := spidomtr.Compare(baseline, current, spidomtr.CompareOptions{})
+	require.True(t, c.Total.Regression)
+	require.False(t, c.Total.Significant)
+	errRate, _ := c.Total.Metric("error_rate")
+	require.InDelta(t, 0.1, errRate.Baseline, 1e-9)
+	require.InDelta(t, 0.2, errRate.Current, 1e-9)
+
+	c = spidomtr.Compare(baseline, current, spidomtr.CompareOptions{ErrorRateTolerance: 0.2})
+	require.False(t, c.Regressed())
+}
+
+func TestComparisonRender(t *testing.T) {
+	baseline := resultOf(map[string][]time.Duration{"a|b": millis(1, 10)}, 0)
+	current := resultOf(map[string][]time.Duration{"a|b": millis(11, 20), "new": millis(1, 10)}, 0)
+	c := spidomtr.Compare(baseline, current, spidomtr.CompareOptions{Percentiles: []int{50}})
+
+	var text strings.Builder
+	require.NoError(t, c.WriteText(&text))
+	require.Contains(t, text.String(), "Test   Metric           Baseline  Current   Change")
+	require.Contains(t, text.String(), "a|b    p50              5.00 ms   15.00 ms  +200.00%")
+	require.Contains(t, text.String(), "new    only in current")
+	require.Contains(t, text.String(), "\na|b: p=0.000 < 0.05, significant, REGRESSION\n")
+
+	var md strings.Builder
+	require.NoError(t, c.WriteMarkdown(&md))
+	require.Contains(t, md.String(), "| Test | Metric | Baseline | Current | Change |\n|---|---|---:|---:|---:|\n")
+	require.Contains(t, md.String(), "| a\\|b | error_rate | 0.00% | 0.00% | n/a |")
+	require.Contains(t, md.String(), "- `a|b`: **p=0.000 < 0.05, significant, REGRESSION**\n")
+	require.Contains(t, md.String(), "| new | only in current | | | |")
+}
@@ -0,0 +1,209 @@
+package spidomtr
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+)
+
+// DefaultMaxErrorClasses is the default number of error classes kept
+// in an error distribution
+const DefaultMaxErrorClasses = 50
+
+// MaxErrorSamples is the number of raw error messages kept as samples
+// of each error class
+const MaxErrorSamples = 3
+
+// OtherErrors is the error class the least frequent errors are counted
+// as, when an error distribution has more classes than the max. The
+// class is reserved, so errors classified as OtherErrors are counted
+// with them.
+const OtherErrors = "(other errors)"
+
+// ErrorClassifier classifies the errors of failed tests, so that errors
+// of the same kind, e.g. "connection refused" to different addresses,
+// are counted as one class in Stats.Errorm
+type ErrorClassifier interface {
+	// Classify returns the class of err, or false if the classifier
+	// does not apply to err
+	Classify(err error) (string, bool)
+}
+
+// ErrorClassifierFunc is a func classifying errors, e.g. by a status
+// code carried by the error
+type ErrorClassifierFunc func(err error) (string, bool)
+
+// Classify calls f(err)
+func (f ErrorClassifierFunc) Classify(err error) (string, bool) {
+	return f(err)
+}
+
+// ClassifyIs classifies errors matching target, as reported by
+// errors.Is, as class
+func ClassifyIs(target error, class string) ErrorClassifier {
+	return ErrorClassifierFunc(func(err error) (string, bool) {
+		return class, errors.Is(err, target)
+	})
+}
+
+// ClassifyAs classifies errors with an error of type T in their chain,
+// as reported by errors.As, as class, e.g.
+//
+//	spidomtr.ClassifyAs[*net.OpError]("network error")
+func ClassifyAs[T error](class string) ErrorClassifier {
+	return ErrorClassifierFunc(func(err error) (string, bool) {
+		var target T
+		return class, errors.As(err, &target)
+	})
+}
+
+// ClassifyRegexp classifies errors with a message matching re by their
+// message normalized by replacing the matches with repl, e.g. with
+// `\d+` and "N", "user 42 not found" is classified as "user N not
+// found". repl may refer to submatches as in Regexp.ReplaceAllString.
+func ClassifyRegexp(re *regexp.Regexp, repl string) ErrorClassifier {
+	return ErrorClassifierFunc(func(err error) (string, bool) {
+		msg := err.Error()
+		if !re.MatchString(msg) {
+			return "", false
+		}
+		return re.ReplaceAllString(msg, repl), true
+	})
+}
+
+// classifyError returns the class of err by the first classifier that
+// applies, or the error message if none does
+func classifyError(classifiers []ErrorClassifier, err error) string {
+	for _, c := range classifiers {
+		if class, ok := c.Classify(err); ok {
+			return class
+		}
+	}
+	return err.Error()
+}
+
+// errorSet counts errors by class, keeping a few distinct messages of
+// each class as samples. With a max above 0, new classes are counted as
+// OtherErrors once there are max classes.
+type errorSet struct {
+	counts  map[string]int
+	max     int
+	samples map[string][]string
+}
+
+func newErrorSet() errorSet {
+	return errorSet{
+		counts:  make(map[string]int),
+		samples: make(map[string][]string),
+	}
+}
+
+func (s errorSet) add(class string, n int, samples ...string) {
+	if _, ok := s.counts[class]; !ok && s.max > 0 && s.classes() >= s.max-1 {
+		class = OtherErrors
+	}
+	s.counts[class] += n
+	for _, sample := range samples {
+		if len(s.samples[class]) >= MaxErrorSamples {
+			return
+		}
+		if !contains(s.samples[class], sample) {
+			s.samples[class] = append(s.samples[class], sample)
+		}
+	}
+}
+
+// classes returns the number of classes, not counting OtherErrors
+func (s errorSet) classes() int {
+	if _, ok := s.counts[OtherErrors]; ok {
+		return len(s.counts) - 1
+	}
+	return len(s.counts)
+}
+
+// addResult adds the error of a test run, if it failed
+func (s errorSet) addResult(r TestResult) {
+	if r.Error == nil {
+		return
+	}
+	class := r.ErrorClass
+	if class == "" {
+		class = r.Error.Error()
+	}
+	s.add(class, 1, r.Error.Error())
+}
+
+// addStats adds an error distribution, e.g. of a user
+func (s errorSet) addStats(stats Stats) {
+	for class, n := range stats.Errorm {
+		s.add(class, n, stats.ErrorSamples[class]...)
+	}
+}
+
+// capped returns the error distribution with at most max classes, where
+// the least frequent classes are counted as OtherErrors. It is not
+// capped if max is 0.
+func (s errorSet) capped(max int) (map[string]int, map[string][]string) {
+	if max <= 0 || len(s.counts) <= max {
+		return s.counts, s.samples
+	}
+
+	classes := make([]string, 0, len(s.counts))
+	for class := range s.counts {
+		if class != OtherErrors {
+			classes = append(classes, class)
+		}
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		if s.counts[classes[i]] != s.counts[classes[j]] {
+			return s.counts[classes[i]] > s.counts[classes[j]]
+		}
+		return classes[i] < classes[j]
+	})
+
+	res := newErrorSet()
+	for i, class := range classes {
+		if i < max-1 {
+			res.add(class, s.counts[class], s.samples[class]...)
+		} else {
+			res.add(OtherErrors, s.counts[class], s.samples[class]...)
+		}
+	}
+	if n, ok := s.counts[OtherErrors]; ok {
+		res.add(OtherErrors, n, s.samples[OtherErrors]...)
+	}
+	return res.counts, res.samples
+}
+
+// CapErrors returns a copy of the result with the error distributions
+// of the total and test stats capped at max classes, where the least
+// frequent classes are counted as OtherErrors. The runner caps its
+// results at the MaxErrorClasses option.
+func (r Result) CapErrors(max int) Result {
+	r.Stats = r.Stats.capErrors(max)
+	testStats := make(map[string]TestStats, len(r.TestStats))
+	for id, ts := range r.TestStats {
+		ts.Stats = ts.Stats.capErrors(max)
+		testStats[id] = ts
+	}
+	r.TestStats = testStats
+	return r
+}
+
+func (stats Stats) capErrors(max int) Stats {
+	if max <= 0 || len(stats.Errorm) <= max {
+		return stats
+	}
+	s := errorSet{counts: stats.Errorm, samples: stats.ErrorSamples}
+	stats.Errorm, stats.ErrorSamples = s.capped(max)
+	return stats
+}
+
+func contains(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
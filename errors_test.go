@@ -0,0 +1,132 @@
+package spidomtr_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+	"github.com/stretchr/testify/require"
+)
+
+var errUnavailable = errors.New("unavailable")
+
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("status %d", e.code)
+}
+
+func TestErrorClassifiers(t *testing.T) {
+	test1 := testunit.New(
+		testunit.ID("get"),
+		testunit.Test(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			i := testunit.Iteration(ctx)
+			if i%2 == 0 {
+				return args, fmt.Errorf("get item %d: %w", i, errUnavailable)
+			}
+			return args, fmt.Errorf("get item %d: %w", i, &statusError{code: 500 + i})
+		}),
+	)
+
+	test2 := testunit.New(
+		testunit.ID("list"),
+		testunit.Test(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			i := testunit.Iteration(ctx)
+			switch i % 4 {
+			case 0:
+				return args, fmt.Errorf("list page %d: %w", i, context.DeadlineExceeded)
+			case 1:
+				return args, fmt.Errorf("user %d not found", i)
+			case 2:
+				return args, errors.New("no digits")
+			}
+			return args, nil
+		}),
+	)
+
+	out := &bytes.Buffer{}
+	runner := spidomtr.NewRunner(
+		spidomtr.ErrorClassifiers(
+			spidomtr.ClassifyIs(errUnavailable, "unavailable"),
+			spidomtr.ClassifyAs[*statusError]("bad status"),
+			spidomtr.ErrorClassifierFunc(func(err error) (string, bool) {
+				return "timeout", errors.Is(err, context.DeadlineExceeded)
+			}),
+			spidomtr.ClassifyRegexp(regexp.MustCompile(`\d+`), "N"),
+		),
+		spidomtr.Iterations(8),
+		spidomtr.Output(out),
+		spidomtr.ShowLogo(false),
+		spidomtr.Users(2),
+	)
+	res := runner.Run(context.Background(), test1, test2)
+
+	require.Equal(t, map[string]int{
+		"unavailable":      8,
+		"bad status":       8,
+		"timeout":          4,
+		"user N not found": 4,
+		"no digits":        4,
+	}, res.Stats.Errorm)
+	require.Equal(t, []string{"get item 0: unavailable", "get item 2: unavailable", "get item 4: unavailable"}, res.Stats.ErrorSamples["unavailable"])
+	require.Equal(t, []string{"no digits"}, res.Stats.ErrorSamples["no digits"])
+	require.Equal(t, map[string]int{"unavailable": 8, "bad status": 8}, res.TestStats["get"].Stats.Errorm)
+	require.Len(t, res.TestStats["list"].Stats.ErrorSamples["timeout"], 2, "samples are distinct")
+	require.Len(t, res.TestStats["get"].Stats.ErrorSamples["bad status"], spidomtr.MaxErrorSamples)
+	require.Equal(t, "bad status", res.TestStats["get"].TestResults[1].ErrorClass)
+	require.Equal(t, "get item 1: status 501", res.TestStats["get"].TestResults[1].Comment)
+
+	require.Contains(t, out.String(), "\nError distribution:\n  [8] bad status\n      get item 1: status 501\n")
+	require.Contains(t, out.String(), "  [4] no digits\n  [4] timeout\n")
+}
+
+func TestMaxErrorClasses(t *testing.T) {
+	test := testunit.New(
+		testunit.ID("test"),
+		testunit.Test(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			// Errors 0 and 1 are the most frequent, while the others
+			// occur once per user
+			i := testunit.Iteration(ctx)
+			if i%2 == 0 {
+				return args, fmt.Errorf("error %d", i%4/2)
+			}
+			return args, fmt.Errorf("error %d", i)
+		}),
+	)
+
+	run := func(options ...spidomtr.Option) spidomtr.Result {
+		runner := spidomtr.NewRunner(append([]spidomtr.Option{
+			spidomtr.Iterations(20),
+			spidomtr.ShowLogo(false),
+			spidomtr.ShowSummary(false),
+			spidomtr.Users(2),
+		}, options...)...)
+		return runner.Run(context.Background(), test)
+	}
+
+	res := run(spidomtr.MaxErrorClasses(3))
+	require.Equal(t, map[string]int{"error 0": 10, "error 1": 12, spidomtr.OtherErrors: 18}, res.Stats.Errorm)
+	require.Equal(t, res.Stats.Errorm, res.TestStats["test"].Stats.Errorm)
+
+	// The users count new classes as other errors during the run
+	for _, child := range res.ChildResults {
+		require.Len(t, child.Stats.Errorm, 3)
+	}
+	require.Equal(t, []string{"error 3", "error 5", "error 7"}, res.Stats.ErrorSamples[spidomtr.OtherErrors])
+
+	// Capping again keeps the other errors
+	capped := res.CapErrors(2)
+	require.Equal(t, map[string]int{"error 1": 12, spidomtr.OtherErrors: 28}, capped.Stats.Errorm)
+	require.Len(t, res.Stats.Errorm, 3)
+
+	res = run(spidomtr.MaxErrorClasses(0))
+	require.Len(t, res.Stats.Errorm, 11)
+	require.Len(t, run().Stats.Errorm, 11)
+}
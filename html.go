@@ -0,0 +1,106 @@
+package spidomtr
+
+import (
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+)
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"join": strings.Join,
+	"mark": toMark,
+	"ms":   msStr,
+	"width": func(count int, buckets []Bucket) int {
+		max := 0
+		for _, b := range buckets {
+			if b.Count > max {
+				max = b.Count
+			}
+		}
+		if max == 0 {
+			return 0
+		}
+		return count * 100 / max
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>spidomtr report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { padding: 0.25em 0.75em; text-align: right; border-bottom: 1px solid #ddd; }
+th:first-child, td:first-child { text-align: left; }
+.bar { background: #4a90d9; height: 0.8em; }
+.fail { color: #c0392b; }
+</style>
+</head>
+<body>
+<h1>spidomtr report</h1>
+<p>{{.Result.Date.Format "2006-01-02 15:04:05 MST"}}</p>
+
+<h2>Summary</h2>
+<table>
+<tr><td>Count</td><td>{{.Result.Stats.Count}}</td></tr>
+<tr><td>Total</td><td>{{.Result.Stats.Duration}}</td></tr>
+<tr><td>Slowest</td><td>{{ms .Result.Stats.Slowest}}</td></tr>
+<tr><td>Fastest</td><td>{{ms .Result.Stats.Fastest}}</td></tr>
+<tr><td>Average</td><td>{{ms .Result.Stats.Average}}</td></tr>
+<tr><td>Req/sec</td><td>{{printf "%.2f" .Result.Stats.RPS}}</td></tr>
+<tr><td>OK</td><td>{{.Result.Stats.Passed}}</td></tr>
+<tr><td>Errored</td><td>{{.Result.Stats.Errors}}</td></tr>
+<tr><td>Skipped</td><td>{{.Result.Stats.Skips}}</td></tr>
+{{- if .Result.Stats.Retries}}
+<tr><td>Retries</td><td>{{.Result.Stats.Retries}} ({{.Result.Stats.PassedRetried}} passed after retry)</td></tr>
+{{- end}}
+</table>
+
+<h2>Response time histogram</h2>
+<table>
+{{- range .Result.Stats.Histogram}}{{if .Count}}
+<tr><td>{{ms .Mark}}</td><td>{{.Count}}</td><td style="width: 30em"><div class="bar" style="width: {{width .Count $.Result.Stats.Histogram}}%"></div></td></tr>
+{{- end}}{{end}}
+</table>
+
+<h2>Latency distribution</h2>
+<table>
+{{- range .Result.Stats.Distributions}}{{if .Latency}}
+<tr><td>{{.Percentage}}%</td><td>{{ms .Latency}}</td></tr>
+{{- end}}{{end}}
+</table>
+{{- if .Result.Stats.Errorm}}
+
+<h2>Error distribution</h2>
+<table>
+{{- range $err, $count := .Result.Stats.Errorm}}
+<tr><td class="fail" title="{{join (index $.Result.Stats.ErrorSamples $err) "\n"}}">{{$err}}</td><td>{{$count}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+
+<h2>Tests</h2>
+<table>
+<tr><th>Test</th><th>Count</th><th>OK</th><th>Errored</th><th>Skipped</th><th>Average</th><th>Fastest</th><th>Slowest</th><th>Req/sec</th></tr>
+{{- range .Tests}}{{$s := index $.Result.TestStats .}}
+<tr><td>{{mark $s}} {{.}}</td><td>{{$s.Stats.Count}}</td><td>{{$s.Stats.Passed}}</td><td>{{$s.Stats.Errors}}</td><td>{{$s.Stats.Skips}}</td><td>{{ms $s.Stats.Average}}</td><td>{{ms $s.Stats.Fastest}}</td><td>{{ms $s.Stats.Slowest}}</td><td>{{printf "%.2f" $s.Stats.RPS}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// WriteHTML writes res as a standalone HTML report to w
+func WriteHTML(w io.Writer, res Result) error {
+	tests := make([]string, 0, len(res.TestStats))
+	for id := range res.TestStats {
+		tests = append(tests, id)
+	}
+	sort.Strings(tests)
+
+	return htmlTemplate.Execute(w, struct {
+		Result Result
+		Tests  []string
+	}{res, tests})
+}
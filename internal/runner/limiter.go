@@ -0,0 +1,44 @@
+package runner
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter paces test starts to a fixed rate, shared by all users
+type Limiter struct {
+	interval time.Duration
+	mu       sync.Mutex
+	next     time.Time
+}
+
+// NewLimiter constructs a limiter allowing rps starts per second
+func NewLimiter(rps float64) *Limiter {
+	return &Limiter{interval: time.Duration(float64(time.Second) / rps)}
+}
+
+// Wait blocks until the next start is allowed, or ctx is done
+func (l *Limiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	t := l.next
+	if t.Before(now) {
+		t = now
+	}
+	l.next = t.Add(l.interval)
+	l.mu.Unlock()
+
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
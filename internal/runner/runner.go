@@ -10,14 +10,23 @@ import (
 	"github.com/spider-pigs/spidomtr/pkg/testunit"
 )
 
+// TestUnitStarted type
+type TestUnitStarted func(t testunit.TestUnit, iteration int)
+
 // TestUnitDone type
-type TestUnitDone func(testunit.TestUnit, *Timer, error)
+type TestUnitDone func(t testunit.TestUnit, iteration int, timer *Timer, rec *testunit.Recorder, err error)
 
 // Runner type
 type Runner struct {
-	Iterations   int
-	TestUnitDone TestUnitDone
-	Timeout      time.Duration
+	// Deadline stops the run when passed, if set
+	Deadline time.Time
+	// Iterations is the number of iterations, or unlimited if 0 and
+	// a deadline is set
+	Iterations      int
+	Limiter         *Limiter
+	TestUnitStarted TestUnitStarted
+	TestUnitDone    TestUnitDone
+	Timeout         time.Duration
 }
 
 // New constructs a new
@@ -33,17 +42,49 @@ func (runner Runner) Run(ctx context.Context, tests ...testunit.TestUnit) *Timer
 	totalTimer := NewTimer()
 	totalTimer.Begin()
 
-	for i := 0; i < runner.Iterations; i++ {
+	unlimited := runner.Iterations <= 0 && !runner.Deadline.IsZero()
+loop:
+	for i := 0; unlimited || i < runner.Iterations; i++ {
+		if runner.done(ctx) {
+			break
+		}
 		for _, t := range tests {
 			var err error
 			timer := NewTimer()
+			rec := testunit.NewRecorder()
 
 			enabled, _ := t.Enabled()
+			if enabled && runner.Limiter != nil {
+				if runner.Limiter.Wait(ctx) != nil || runner.done(ctx) {
+					break loop
+				}
+			}
+			tctx := testunit.WithIteration(testunit.WithRecorder(ctx, rec), i)
+			var exhausted bool
+			if enabled {
+				err = feed(tctx, t, rec)
+				exhausted = errors.Is(err, testunit.ErrExhausted)
+				enabled = !exhausted
+			}
+			if enabled && err == nil && think(ctx, t) != nil {
+				break loop
+			}
 			if enabled {
-				timer, err = runTestUnit(ctx, t, runner.Timeout)
+				if runner.TestUnitStarted != nil {
+					runner.TestUnitStarted(t, i)
+				}
+				if err == nil {
+					timer, err = runTestUnit(tctx, t, runner.Timeout)
+				}
 			}
 			if runner.TestUnitDone != nil {
-				runner.TestUnitDone(t, timer, err)
+				runner.TestUnitDone(t, i, timer, rec, err)
+			}
+
+			// Stop once the records have run out, reporting the
+			// iteration as skipped
+			if exhausted {
+				break loop
 			}
 		}
 	}
@@ -52,6 +93,46 @@ func (runner Runner) Run(ctx context.Context, tests ...testunit.TestUnit) *Timer
 	return totalTimer
 }
 
+// done returns if the deadline has passed or ctx is done
+func (runner Runner) done(ctx context.Context) bool {
+	if !runner.Deadline.IsZero() && !time.Now().Before(runner.Deadline) {
+		return true
+	}
+	return ctx.Err() != nil
+}
+
+// feed fetches the record of the iteration from the feeder of t, if
+// it has one
+func feed(ctx context.Context, t testunit.TestUnit, rec *testunit.Recorder) error {
+	ft, ok := t.(testunit.FedTestUnit)
+	if !ok || ft.Feeder() == nil {
+		return nil
+	}
+	record, err := ft.Feeder().Next(ctx)
+	if err != nil {
+		return err
+	}
+	rec.SetRecord(record)
+	return nil
+}
+
+// think waits out the think time of t, if it has one, outside of the
+// test timeout
+func think(ctx context.Context, t testunit.TestUnit) error {
+	pt, ok := t.(testunit.PausedTestUnit)
+	if !ok || pt.ThinkTime() <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(pt.ThinkTime())
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func runTestUnit(ctx context.Context, t testunit.TestUnit, timeout time.Duration) (*Timer, error) {
 	timer := NewTimer()
 	var err error
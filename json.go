@@ -0,0 +1,41 @@
+package spidomtr
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// testResultJSON is the JSON representation of a TestResult, with the
+// error encoded as its message
+type testResultJSON struct {
+	testResultAlias
+	Error string `json:",omitempty"`
+}
+
+type testResultAlias TestResult
+
+// MarshalJSON encodes the test result as JSON, with the error as its
+// message
+func (r TestResult) MarshalJSON() ([]byte, error) {
+	v := testResultJSON{testResultAlias: testResultAlias(r)}
+	v.testResultAlias.Error = nil
+	if r.Error != nil {
+		v.Error = r.Error.Error()
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes a test result encoded by MarshalJSON. The error
+// is restored as an error with the same message.
+func (r *TestResult) UnmarshalJSON(b []byte) error {
+	var v testResultJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*r = TestResult(v.testResultAlias)
+	r.Error = nil
+	if v.Error != "" {
+		r.Error = errors.New(v.Error)
+	}
+	return nil
+}
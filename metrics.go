@@ -0,0 +1,279 @@
+package spidomtr
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+)
+
+// Custom metric kinds. Counters are kept in Stats.Counters.
+const (
+	CounterKind   = "counter"
+	GaugeKind     = "gauge"
+	HistogramKind = "histogram"
+	TrendKind     = "trend"
+)
+
+// Metrics reports custom metrics of a test run, e.g.
+//
+//	spidomtr.MetricsFromContext(ctx).Counter("bytes").Add(n)
+//
+// Metric names are shared by all kinds, so a name should only be used
+// for one kind.
+type Metrics struct {
+	rec *testunit.Recorder
+}
+
+// MetricsFromContext returns the metrics of the test run ctx belongs
+// to. Metrics reported on a ctx that does not belong to a test run are
+// dropped.
+func MetricsFromContext(ctx context.Context) *Metrics {
+	return &Metrics{rec: testunit.RecorderFromContext(ctx)}
+}
+
+// Counter returns the named counter, which is summed up
+func (m *Metrics) Counter(name string) Counter {
+	return Counter{name: name, rec: m.rec}
+}
+
+// Gauge returns the named gauge, which keeps its last value
+func (m *Metrics) Gauge(name string) Gauge {
+	return Gauge{name: name, rec: m.rec}
+}
+
+// Histogram returns the named histogram, which keeps the distribution
+// of its values
+func (m *Metrics) Histogram(name string) Histogram {
+	return Histogram{name: name, rec: m.rec}
+}
+
+// Trend returns the named trend, which keeps the distribution of its
+// durations
+func (m *Metrics) Trend(name string) Trend {
+	return Trend{name: name, rec: m.rec}
+}
+
+// Counter is a custom metric summing up values, e.g. bytes received
+type Counter struct {
+	name string
+	rec  *testunit.Recorder
+}
+
+// Add adds n to the counter
+func (c Counter) Add(n int64) {
+	if c.rec != nil {
+		c.rec.Count(c.name, n)
+	}
+}
+
+// Gauge is a custom metric keeping its last value, e.g. a queue depth
+type Gauge struct {
+	name string
+	rec  *testunit.Recorder
+}
+
+// Set sets the gauge to v
+func (g Gauge) Set(v float64) {
+	if g.rec != nil {
+		g.rec.SetGauge(g.name, v)
+	}
+}
+
+// Histogram is a custom metric keeping the distribution of its values,
+// e.g. the number of items returned
+type Histogram struct {
+	name string
+	rec  *testunit.Recorder
+}
+
+// Observe adds v to the histogram
+func (h Histogram) Observe(v float64) {
+	if h.rec != nil {
+		h.rec.Observe(h.name, v)
+	}
+}
+
+// Trend is a custom metric keeping the distribution of its durations,
+// e.g. the time a message spends in a queue
+type Trend struct {
+	name string
+	rec  *testunit.Recorder
+}
+
+// Add adds d to the trend
+func (t Trend) Add(d time.Duration) {
+	if t.rec != nil {
+		t.rec.Trend(t.name, d)
+	}
+}
+
+// MetricStats is the aggregate of a custom gauge, histogram or trend
+// metric. Gauges have a value per test run. Trend values are in
+// nanoseconds.
+type MetricStats struct {
+	Count         int
+	Distributions []ValueDist
+	Kind          string
+	Last          float64
+	LastDate      time.Time
+	Max           float64
+	Mean          float64
+	Min           float64
+	Sum           float64
+	// Values are the sorted values of the metric. They are not saved
+	// with a result, so the percentiles of a loaded result are those of
+	// the Distributions.
+	Values []float64 `json:"-"`
+}
+
+// ValueDist type
+type ValueDist struct {
+	Percentage int
+	Value      float64
+}
+
+// metricSet collects the values of custom metrics by name
+type metricSet map[string]*metricValues
+
+type metricValues struct {
+	kind     string
+	last     float64
+	lastDate time.Time
+	values   []float64
+}
+
+func (s metricSet) add(kind, name string, date time.Time, values ...float64) {
+	m, ok := s[name]
+	if !ok {
+		m = &metricValues{kind: kind}
+		s[name] = m
+	}
+	m.values = append(m.values, values...)
+	if len(values) > 0 && !date.Before(m.lastDate) {
+		m.last = values[len(values)-1]
+		m.lastDate = date
+	}
+}
+
+// addResult adds the custom metrics reported by a test run
+func (s metricSet) addResult(r TestResult) {
+	for name, v := range r.Gauges {
+		s.add(GaugeKind, name, r.Date, v)
+	}
+	for name, values := range r.Histograms {
+		s.add(HistogramKind, name, r.Date, values...)
+	}
+	for name, durations := range r.Trends {
+		values := make([]float64, len(durations))
+		for i, d := range durations {
+			values[i] = float64(d)
+		}
+		s.add(TrendKind, name, r.Date, values...)
+	}
+}
+
+func (s metricSet) stats(percentiles []int) map[string]MetricStats {
+	if len(s) == 0 {
+		return nil
+	}
+	res := make(map[string]MetricStats, len(s))
+	for name, m := range s {
+		values := m.values
+		sort.Float64s(values)
+		ms := MetricStats{
+			Count:    len(values),
+			Kind:     m.kind,
+			Last:     m.last,
+			LastDate: m.lastDate,
+			Values:   values,
+		}
+		if len(values) > 0 {
+			for _, v := range values {
+				ms.Sum += v
+			}
+			ms.Max = values[len(values)-1]
+			ms.Mean = ms.Sum / float64(len(values))
+			ms.Min = values[0]
+			for _, p := range percentiles {
+				ms.Distributions = append(ms.Distributions, ValueDist{Percentage: p, Value: percentile(values, p)})
+			}
+		}
+		res[name] = ms
+	}
+	return res
+}
+
+// Percentile returns the pth percentile of the values, or the
+// distribution of p if the values are not kept, e.g. in a loaded result.
+// It returns NaN if neither the values nor the distribution of p are
+// kept.
+func (m MetricStats) Percentile(p int) float64 {
+	if len(m.Values) == 0 {
+		for _, d := range m.Distributions {
+			if d.Percentage == p {
+				return d.Value
+			}
+		}
+		return math.NaN()
+	}
+	return percentile(m.Values, p)
+}
+
+// customMetric splits a custom metric threshold name, e.g. "bytes.total"
+// or "queue.p99", into the metric name and aggregate
+func customMetric(metric string) (string, string, bool) {
+	i := strings.LastIndex(metric, ".")
+	if i <= 0 {
+		return "", "", false
+	}
+	name, agg := metric[:i], metric[i+1:]
+	switch agg {
+	case "total", "count", "sum", "avg", "min", "max", "last":
+		return name, agg, true
+	}
+	if _, ok := percentileMetric(agg); ok {
+		return name, agg, true
+	}
+	return "", "", false
+}
+
+// customValue returns the aggregate of a custom metric, or NaN if it was
+// not reported
+func customValue(stats Stats, name, agg string) float64 {
+	if agg == "total" {
+		return float64(stats.Counters[name])
+	}
+	m, ok := stats.Metrics[name]
+	if !ok || m.Count == 0 {
+		return math.NaN()
+	}
+	switch agg {
+	case "count":
+		return float64(m.Count)
+	case "sum":
+		return m.Sum
+	case "avg":
+		return m.Mean
+	case "min":
+		return m.Min
+	case "max":
+		return m.Max
+	case "last":
+		return m.Last
+	}
+	p, _ := percentileMetric(agg)
+	return m.Percentile(p)
+}
+
+// formatValue formats a custom metric value of kind
+func formatValue(kind string, v float64) string {
+	if kind == TrendKind {
+		return msStr(time.Duration(v))
+	}
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
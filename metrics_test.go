@@ -0,0 +1,104 @@
+package spidomtr_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	test1 := testunit.New(
+		testunit.ID("a"),
+		testunit.Test(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			m := spidomtr.MetricsFromContext(ctx)
+			m.Counter("bytes").Add(100)
+			m.Gauge("queue").Set(float64(testunit.Iteration(ctx)))
+			m.Histogram("items").Observe(1)
+			m.Histogram("items").Observe(2)
+			m.Trend("wait").Add(time.Millisecond)
+			return args, nil
+		}),
+	)
+
+	test2 := testunit.New(
+		testunit.ID("b"),
+		testunit.Test(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			m := spidomtr.MetricsFromContext(ctx)
+			m.Counter("bytes").Add(100)
+			m.Gauge("queue").Set(float64(testunit.Iteration(ctx)))
+			m.Histogram("items").Observe(10)
+			m.Histogram("items").Observe(20)
+			m.Trend("wait").Add(10 * time.Millisecond)
+			return args, nil
+		}),
+	)
+
+	out := &bytes.Buffer{}
+	runner := spidomtr.NewRunner(
+		spidomtr.Iterations(3),
+		spidomtr.Output(out),
+		spidomtr.ShowLogo(false),
+		spidomtr.Users(2),
+	)
+	res := runner.Run(context.Background(), test1, test2)
+
+	require.Equal(t, int64(1200), res.Stats.Counters["bytes"])
+
+	items := res.Stats.Metrics["items"]
+	require.Equal(t, spidomtr.HistogramKind, items.Kind)
+	require.Equal(t, 24, items.Count)
+	require.Equal(t, float64(1), items.Min)
+	require.Equal(t, float64(20), items.Max)
+	require.Equal(t, 8.25, items.Mean)
+
+	queue := res.Stats.Metrics["queue"]
+	require.Equal(t, spidomtr.GaugeKind, queue.Kind)
+	require.Equal(t, 12, queue.Count)
+	require.Equal(t, float64(2), queue.Last)
+
+	wait := res.TestStats["b"].Stats.Metrics["wait"]
+	require.Equal(t, spidomtr.TrendKind, wait.Kind)
+	require.Equal(t, 6, wait.Count)
+	require.Equal(t, float64(10*time.Millisecond), wait.Percentile(99))
+	require.Equal(t, float64(18), res.TestStats["a"].Stats.Metrics["items"].Sum)
+
+	require.Contains(t, out.String(), "\nMetrics:\n")
+	require.Contains(t, out.String(), "items:             avg 8.25, min 1, max 20, 90% 20, 95% 20, 99% 20\n")
+	require.Contains(t, out.String(), "queue:             last 2, avg 1, min 0, max 2\n")
+	require.Contains(t, out.String(), "wait:              avg 5.50 ms, min 1.00 ms, max 10.00 ms, 90% 10.00 ms")
+
+	violations := res.Check(
+		spidomtr.MustParseThreshold("bytes.total >= 1200"),
+		spidomtr.MustParseThreshold("items.avg < 10"),
+		spidomtr.MustParseThreshold("queue.last == 2"),
+		spidomtr.MustParseThreshold("items.count == 12").ForTest("a"),
+		spidomtr.MustParseThreshold("wait.p99 < 5ms"),
+		spidomtr.MustParseThreshold("missing.max < 1"),
+	)
+	require.Len(t, violations, 2)
+	require.Equal(t, "expected wait.p99 < 5ms, observed wait.p99 = 10ms", violations[0].String())
+	require.Equal(t, "expected missing.max < 1, observed no results", violations[1].String())
+
+	// The values are not saved, so loaded results are joined from the
+	// test results
+	b, err := json.Marshal(res)
+	require.NoError(t, err)
+	require.NotContains(t, string(b), `"Values"`)
+	var loaded spidomtr.Result
+	require.NoError(t, json.Unmarshal(b, &loaded))
+	require.Equal(t, float64(10*time.Millisecond), loaded.TestStats["b"].Stats.Metrics["wait"].Percentile(99))
+	require.True(t, math.IsNaN(loaded.TestStats["b"].Stats.Metrics["wait"].Percentile(42)))
+	joined := spidomtr.JoinResults(spidomtr.DefaultHistogramBuckets, spidomtr.DefaultPercentiles, loaded, loaded)
+	require.Equal(t, 48, joined.Stats.Metrics["items"].Count)
+	require.Equal(t, float64(20), joined.Stats.Metrics["items"].Percentile(99))
+
+	// Metrics outside of a test run are dropped
+	spidomtr.MetricsFromContext(context.Background()).Counter("bytes").Add(1)
+}
@@ -0,0 +1,65 @@
+package benchunit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+)
+
+// Func constructs a test unit from a benchmark style func, run once per
+// iteration. A returned error fails the test.
+func Func(id string, f func(ctx context.Context) error) *testunit.TestAssembly {
+	return testunit.New(
+		testunit.ID(id),
+		testunit.Test(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			return args, f(ctx)
+		}),
+	)
+}
+
+// Body constructs a test unit from the loop body of a benchmark, i.e.
+// the code run b.N times in a func BenchmarkX(b *testing.B), run once
+// per iteration. A panic fails the test.
+func Body(id string, body func()) *testunit.TestAssembly {
+	return Func(id, func(context.Context) error {
+		body()
+		return nil
+	})
+}
+
+// Run runs runner as a Go benchmark, with b.N iterations spread over
+// the users of the runner. Each user runs b.N/users iterations rounded
+// up, so up to users-1 more than b.N iterations are run when b.N is not
+// a multiple of users. The number of iterations is decided by b.N, so
+// a Duration of the runner is ignored. The latency percentiles p50, p90
+// and p99 and the number of errors are reported as custom benchmark
+// metrics.
+func Run(b *testing.B, runner *spidomtr.Runner, tests ...testunit.TestUnit) spidomtr.Result {
+	b.Helper()
+
+	users := runner.Config().Users
+	if users < 1 {
+		users = 1
+	}
+	iterations := (b.N + users - 1) / users
+
+	r := runner.With(
+		spidomtr.Duration(0),
+		spidomtr.Iterations(iterations),
+		spidomtr.ShowLogo(false),
+		spidomtr.ShowSummary(false),
+	)
+
+	b.ResetTimer()
+	res := r.Run(context.Background(), tests...)
+	b.StopTimer()
+
+	b.ReportMetric(float64(res.Stats.Percentile(50)), "p50-ns")
+	b.ReportMetric(float64(res.Stats.Percentile(90)), "p90-ns")
+	b.ReportMetric(float64(res.Stats.Percentile(99)), "p99-ns")
+	b.ReportMetric(float64(res.Stats.Errors), "errors")
+
+	return res
+}
@@ -0,0 +1,68 @@
+package benchunit_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/benchunit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdapters(t *testing.T) {
+	var n int
+	sum := benchunit.Body("sum", func() {
+		n += len(strings.Fields("spider pigs are awesome"))
+	})
+	fail := benchunit.Func("fail", func(ctx context.Context) error {
+		return errors.New("whooops")
+	})
+	panics := benchunit.Body("panics", func() {
+		panic("whooops")
+	})
+
+	runner := spidomtr.NewRunner(
+		spidomtr.Iterations(10),
+		spidomtr.ShowLogo(false),
+		spidomtr.ShowSummary(false),
+	)
+	res := runner.Run(context.Background(), sum, fail, panics)
+	require.Equal(t, 40, n)
+	require.Equal(t, 10, res.TestStats["sum"].Stats.Passed)
+	require.Equal(t, map[string]int{"whooops": 10}, res.TestStats["fail"].Stats.Errorm)
+	require.Equal(t, map[string]int{"func panic: whooops": 10}, res.TestStats["panics"].Stats.Errorm)
+}
+
+func TestRun(t *testing.T) {
+	// The duration is ignored
+	runner := spidomtr.NewRunner(spidomtr.Duration(time.Hour), spidomtr.Users(4))
+	test := benchunit.Func("sleep", func(ctx context.Context) error {
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+
+	var res spidomtr.Result
+	br := testing.Benchmark(func(b *testing.B) {
+		res = benchunit.Run(b, runner, test)
+	})
+
+	require.GreaterOrEqual(t, res.Stats.Count, br.N)
+	require.Less(t, res.Stats.Count, br.N+4)
+	require.Equal(t, 0, res.Stats.Errors)
+	require.Contains(t, br.Extra, "p50-ns")
+	require.Contains(t, br.Extra, "p99-ns")
+	require.GreaterOrEqual(t, br.Extra["p99-ns"], br.Extra["p50-ns"])
+	require.GreaterOrEqual(t, br.Extra["p50-ns"], float64(time.Millisecond))
+	require.Equal(t, float64(0), br.Extra["errors"])
+}
+
+func BenchmarkRun(b *testing.B) {
+	runner := spidomtr.NewRunner(spidomtr.Users(4))
+	test := benchunit.Body("fields", func() {
+		strings.Fields("spider pigs are awesome")
+	})
+	benchunit.Run(b, runner, test)
+}
@@ -0,0 +1,3 @@
+// Package benchunit adapts Go benchmark code to spidomtr test units,
+// and runs spidomtr runners as Go benchmarks
+package benchunit
@@ -0,0 +1,316 @@
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+)
+
+// Coordinator runs tests on workers
+type Coordinator struct {
+	client  *http.Client
+	cfg     spidomtr.Config
+	workers []string
+}
+
+// NewCoordinator constructs a new coordinator running tests on the
+// workers at the base URLs, e.g. "http://host1:7070", with the runner
+// options
+func NewCoordinator(workers []string, options ...spidomtr.Option) *Coordinator {
+	return &Coordinator{
+		client:  http.DefaultClient,
+		cfg:     spidomtr.NewRunner(options...).Config(),
+		workers: workers,
+	}
+}
+
+// Config returns a copy of the runner config
+func (c *Coordinator) Config() spidomtr.Config {
+	return c.cfg
+}
+
+// assignment is a job assigned to a worker
+type assignment struct {
+	job    Job
+	offset int
+	worker string
+}
+
+// startDelay is the time from the workers being reserved until they
+// start, for the jobs to reach all of them
+const startDelay = 250 * time.Millisecond
+
+// Run runs the tests registered with the IDs on the workers, notifying
+// the handlers of the runner config as the workers start and complete
+// tests, and returns the joined result. It fails if any worker fails
+// the job, returning the joined result of the workers that completed
+// it.
+func (c *Coordinator) Run(ctx context.Context, tests ...string) (spidomtr.Result, error) {
+	assignments := c.assign(tests)
+	if len(assignments) == 0 {
+		return spidomtr.Result{}, errors.New("no workers")
+	}
+
+	// Reserve all workers for their jobs before starting any
+	errs := make([]error, len(assignments))
+	var wg sync.WaitGroup
+	for i := range assignments {
+		wg.Add(1)
+		go func(a *assignment, i int) {
+			defer wg.Done()
+			a.job.Reservation, errs[i] = c.prepare(ctx, *a)
+		}(&assignments[i], i)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		for _, a := range assignments {
+			if a.job.Reservation != "" {
+				c.release(a)
+			}
+		}
+		return spidomtr.Result{}, err
+	}
+
+	count := len(tests) * c.cfg.Iterations * c.cfg.Users
+	if c.cfg.TotalIterations > 0 {
+		count = len(tests) * c.cfg.TotalIterations
+	}
+	if c.cfg.Duration > 0 {
+		count = 0
+	}
+	for _, h := range c.cfg.Handlers {
+		if ch, ok := h.(spidomtr.ConfigHandler); ok {
+			ch.RunnerConfig(c.cfg)
+		}
+	}
+	for _, h := range c.cfg.Handlers {
+		h.RunnerStarted(c.cfg.ID, c.cfg.Description, count)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	notify := func(msg message) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, h := range c.cfg.Handlers {
+			notifyHandler(h, msg)
+		}
+	}
+
+	// Stop all workers on the first failure, which is the one reported
+	start := time.Now().Add(startDelay)
+	var once sync.Once
+	var runErr error
+	results := make([]spidomtr.Result, len(assignments))
+	for i, a := range assignments {
+		a.job.Start = start
+		wg.Add(1)
+		go func(i int, a assignment) {
+			defer wg.Done()
+			var err error
+			results[i], err = c.run(ctx, a, notify)
+			if err != nil {
+				once.Do(func() {
+					runErr = err
+					cancel()
+				})
+			}
+		}(i, a)
+	}
+	wg.Wait()
+
+	// Handlers are notified even if a worker failed, e.g. to flush
+	completed := make([]spidomtr.Result, 0, len(results))
+	for _, res := range results {
+		if !res.Stats.Start.IsZero() {
+			completed = append(completed, res)
+		}
+	}
+	var sum spidomtr.Result
+	if len(completed) > 0 {
+		sum = spidomtr.JoinResults(c.cfg.HistogramBuckets, c.cfg.Percentiles, completed...).CapErrors(c.cfg.MaxErrorClasses)
+	}
+	for _, h := range c.cfg.Handlers {
+		h.RunnerDone(sum)
+	}
+	if runErr != nil {
+		return sum, runErr
+	}
+	if c.cfg.ShowSummary {
+		spidomtr.WriteSummary(c.cfg.Output, sum)
+	}
+	return sum, nil
+}
+
+// notifyHandler notifies h of a message from a worker
+func notifyHandler(h spidomtr.RunnerHandler, msg message) {
+	switch {
+	case msg.Test != nil:
+		h.TestDone(*msg.Test)
+	case msg.TestStarted != nil:
+		if sh, ok := h.(spidomtr.TestStartedHandler); ok {
+			sh.TestStarted(msg.TestStarted.ID, msg.TestStarted.User, msg.TestStarted.Iteration)
+		}
+	case msg.UserStarted != nil:
+		if uh, ok := h.(spidomtr.UserHandler); ok {
+			uh.UserStarted(*msg.UserStarted)
+		}
+	case msg.UserDone != nil:
+		if uh, ok := h.(spidomtr.UserHandler); ok {
+			uh.UserDone(*msg.UserDone)
+		}
+	}
+}
+
+// assign splits the users and rate evenly between the workers
+func (c *Coordinator) assign(tests []string) []assignment {
+	cfg := c.cfg
+	cfg.Handlers = nil
+	cfg.Output = nil
+	cfg.ShowLogo = false
+	cfg.ShowSummary = false
+
+	assignments := make([]assignment, 0, len(c.workers))
+	offset := 0
+	for i, worker := range c.workers {
+		users := c.cfg.Users / len(c.workers)
+		if i < c.cfg.Users%len(c.workers) {
+			users++
+		}
+		if users == 0 {
+			continue
+		}
+		job := Job{Config: cfg, Tests: tests}
+		job.Config.Users = users
+		job.Config.Rate = c.cfg.Rate * float64(users) / float64(c.cfg.Users)
+		if c.cfg.TotalIterations > 0 {
+			// The iterations of the users of the worker, as if all users
+			// were run by one runner
+			job.Config.TotalIterations = 0
+			for user := offset; user < offset+users; user++ {
+				job.Config.TotalIterations += c.cfg.UserIterations(user)
+			}
+			if job.Config.TotalIterations == 0 {
+				offset += users
+				continue
+			}
+		}
+		assignments = append(assignments, assignment{job: job, offset: offset, worker: worker})
+		offset += users
+	}
+	return assignments
+}
+
+// prepare reserves a worker for its job, and returns the reservation
+func (c *Coordinator) prepare(ctx context.Context, a assignment) (string, error) {
+	resp, err := c.post(ctx, a, "/prepare")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var r reservation
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return "", &WorkerError{Err: err, Worker: a.worker}
+	}
+	return r.Reservation, nil
+}
+
+// release releases a worker from a job that is not run. A worker that
+// cannot be reached is released when the reservation times out.
+func (c *Coordinator) release(a assignment) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if resp, err := c.post(ctx, a, "/release"); err == nil {
+		resp.Body.Close()
+	}
+}
+
+// run runs a job on a worker, notifying of its messages with users
+// numbered across all workers, and returns its result
+func (c *Coordinator) run(ctx context.Context, a assignment, notify func(message)) (spidomtr.Result, error) {
+	resp, err := c.post(ctx, a, "/run")
+	if err != nil {
+		return spidomtr.Result{}, err
+	}
+	defer resp.Body.Close()
+
+	// Users of a failed worker are done
+	started := make(map[int]bool)
+	defer func() {
+		for user := range started {
+			user := user
+			notify(message{UserDone: &user})
+		}
+	}()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg message
+		if err := dec.Decode(&msg); err != nil {
+			if err == io.EOF {
+				err = errors.New("stream ended without a result")
+			}
+			return spidomtr.Result{}, &WorkerError{Err: err, Worker: a.worker}
+		}
+		switch {
+		case msg.Test != nil:
+			msg.Test.User += a.offset
+		case msg.TestStarted != nil:
+			msg.TestStarted.User += a.offset
+		case msg.UserStarted != nil:
+			*msg.UserStarted += a.offset
+			started[*msg.UserStarted] = true
+		case msg.UserDone != nil:
+			*msg.UserDone += a.offset
+			delete(started, *msg.UserDone)
+		}
+		if res := msg.Result; res != nil {
+			for _, ts := range res.TestStats {
+				for i := range ts.TestResults {
+					ts.TestResults[i].User += a.offset
+				}
+			}
+			return *res, nil
+		}
+		notify(msg)
+	}
+}
+
+func (c *Coordinator) post(ctx context.Context, a assignment, path string) (*http.Response, error) {
+	b, err := json.Marshal(a.job)
+	if err != nil {
+		return nil, err
+	}
+	url := strings.TrimSuffix(a.worker, "/") + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return nil, &WorkerError{Err: err, Worker: a.worker}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, &WorkerError{Err: err, Worker: a.worker}
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &WorkerError{
+			Err:    fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg))),
+			Worker: a.worker,
+		}
+	}
+	return resp, nil
+}
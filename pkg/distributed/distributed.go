@@ -0,0 +1,82 @@
+// Package distributed generates load from several worker processes,
+// run by a coordinator.
+//
+// Workers register the tests they can run by ID, and serve the
+// protocol over HTTP:
+//
+//	w := distributed.NewWorker(httpunit.New(http.MethodGet, url, httpunit.ID("get-items")))
+//	log.Fatal(http.ListenAndServe(":7070", w))
+//
+// The coordinator splits the users, and the rate if any, of the runner
+// config between the workers, reserves all of them for the job, starts
+// them together at a shared start time, streams back the test results
+// as they are completed, and joins the results of the workers into
+// one:
+//
+//	c := distributed.NewCoordinator(
+//		[]string{"http://host1:7070", "http://host2:7070"},
+//		spidomtr.Users(100),
+//		spidomtr.Iterations(1000),
+//	)
+//	res, err := c.Run(ctx, "get-items")
+//
+// Users are numbered across all workers in the test results, starting
+// at 0 on the first worker. testunit.User reports the user number local
+// to the worker. The clocks of the workers should be synchronized, e.g.
+// by NTP, for them to start together.
+package distributed
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+)
+
+// Job is the part of a run given to a worker
+type Job struct {
+	Config spidomtr.Config
+	// Reservation is the reservation of the worker for the job, made
+	// by /prepare
+	Reservation string `json:",omitempty"`
+	// Start is when the worker starts the job
+	Start time.Time
+	Tests []string
+}
+
+// message is a line of the newline delimited JSON stream of a run, with
+// either a user started or done, a test started or completed, or the
+// result of the run
+type message struct {
+	Result      *spidomtr.Result     `json:",omitempty"`
+	Test        *spidomtr.TestResult `json:",omitempty"`
+	TestStarted *testStarted         `json:",omitempty"`
+	UserDone    *int                 `json:",omitempty"`
+	UserStarted *int                 `json:",omitempty"`
+}
+
+// testStarted is a test started by a user
+type testStarted struct {
+	ID        string
+	Iteration int
+	User      int
+}
+
+// reservation is the response to /prepare
+type reservation struct {
+	Reservation string
+}
+
+// WorkerError is the error of a worker failing a job
+type WorkerError struct {
+	Err    error
+	Worker string
+}
+
+func (e *WorkerError) Error() string {
+	return fmt.Sprintf("worker %s: %v", e.Worker, e.Err)
+}
+
+func (e *WorkerError) Unwrap() error {
+	return e.Err
+}
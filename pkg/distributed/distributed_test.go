@@ -0,0 +1,266 @@
+package distributed_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/distributed"
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+	"github.com/stretchr/testify/require"
+)
+
+type collector struct {
+	mu      sync.Mutex
+	count   int
+	results []spidomtr.TestResult
+	started int
+	users   map[int]int
+	done    bool
+}
+
+func (c *collector) RunnerStarted(id, description string, count int) {
+	c.count = count
+}
+
+func (c *collector) TestDone(res spidomtr.TestResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results = append(c.results, res)
+}
+
+func (c *collector) RunnerDone(res spidomtr.Result) {
+	c.done = true
+}
+
+func (c *collector) TestStarted(id string, user, iteration int) {
+	c.started++
+}
+
+func (c *collector) UserStarted(user int) {
+	if c.users == nil {
+		c.users = make(map[int]int)
+	}
+	c.users[user]++
+}
+
+func (c *collector) UserDone(user int) {
+	c.users[user]--
+}
+
+func workers(t *testing.T, n int, calls *int64) []string {
+	urls := make([]string, n)
+	for i := range urls {
+		w := distributed.NewWorker(
+			testunit.New(
+				testunit.ID("pass"),
+				testunit.Test(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+					atomic.AddInt64(calls, 1)
+					return args, nil
+				}),
+			),
+			testunit.New(
+				testunit.ID("fail"),
+				testunit.Test(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+					atomic.AddInt64(calls, 1)
+					return args, errors.New("whooops")
+				}),
+			),
+		)
+		srv := httptest.NewServer(w)
+		t.Cleanup(srv.Close)
+		urls[i] = srv.URL
+	}
+	return urls
+}
+
+func TestRun(t *testing.T) {
+	var calls int64
+	h := &collector{}
+	c := distributed.NewCoordinator(workers(t, 3, &calls),
+		spidomtr.Handlers(h),
+		spidomtr.Iterations(4),
+		spidomtr.ShowSummary(false),
+		spidomtr.Users(5),
+	)
+
+	res, err := c.Run(context.Background(), "pass", "fail")
+	require.NoError(t, err)
+	require.Equal(t, int64(40), calls)
+	require.Equal(t, 40, res.Stats.Count)
+	require.Equal(t, 20, res.Stats.Passed)
+	require.Equal(t, 20, res.Stats.Errors)
+	require.Equal(t, map[string]int{"whooops": 20}, res.Stats.Errorm)
+	require.Len(t, res.Stats.Distributions, len(spidomtr.DefaultPercentiles))
+
+	// Users are numbered across workers
+	users := make(map[int]int)
+	for _, r := range res.TestStats["pass"].TestResults {
+		users[r.User]++
+	}
+	require.Equal(t, map[int]int{0: 4, 1: 4, 2: 4, 3: 4, 4: 4}, users)
+	require.EqualError(t, res.TestStats["fail"].TestResults[0].Error, "whooops")
+
+	require.Equal(t, 40, h.count)
+	require.Len(t, h.results, 40)
+	require.Equal(t, 40, h.started)
+	require.Equal(t, map[int]int{0: 0, 1: 0, 2: 0, 3: 0, 4: 0}, h.users)
+	require.True(t, h.done)
+}
+
+func TestRunMoreWorkersThanUsers(t *testing.T) {
+	var calls int64
+	c := distributed.NewCoordinator(workers(t, 3, &calls),
+		spidomtr.Iterations(2),
+		spidomtr.ShowSummary(false),
+		spidomtr.Users(2),
+	)
+
+	res, err := c.Run(context.Background(), "pass")
+	require.NoError(t, err)
+	require.Equal(t, 4, res.Stats.Count)
+	require.Equal(t, int64(4), calls)
+}
+
+func TestRunTotalIterations(t *testing.T) {
+	var calls int64
+	c := distributed.NewCoordinator(workers(t, 3, &calls),
+		spidomtr.ShowSummary(false),
+		spidomtr.TotalIterations(7),
+		spidomtr.Users(5),
+	)
+
+	res, err := c.Run(context.Background(), "pass")
+	require.NoError(t, err)
+	require.Equal(t, 7, res.Stats.Count)
+	require.Equal(t, int64(7), calls)
+
+	users := make(map[int]int)
+	for _, r := range res.TestStats["pass"].TestResults {
+		users[r.User]++
+	}
+	require.Equal(t, map[int]int{0: 2, 1: 2, 2: 1, 3: 1, 4: 1}, users)
+}
+
+func TestRunErrors(t *testing.T) {
+	var calls int64
+	urls := workers(t, 2, &calls)
+	c := distributed.NewCoordinator(urls, spidomtr.ShowSummary(false), spidomtr.Users(2))
+
+	// No worker starts unless all accept the job
+	_, err := c.Run(context.Background(), "pass", "missing")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `worker `+urls[0]+`: 400 Bad Request: unknown test "missing"`)
+	require.Zero(t, calls)
+
+	srv := httptest.NewServer(distributed.NewWorker())
+	srv.Close()
+	c = distributed.NewCoordinator(append(urls, srv.URL), spidomtr.ShowSummary(false), spidomtr.Users(3))
+	_, err = c.Run(context.Background(), "pass")
+	var werr *distributed.WorkerError
+	require.ErrorAs(t, err, &werr)
+	require.Equal(t, srv.URL, werr.Worker)
+	require.Zero(t, calls)
+
+	// The reserved workers are released
+	c = distributed.NewCoordinator(urls, spidomtr.ShowSummary(false), spidomtr.Users(2))
+	_, err = c.Run(context.Background(), "pass")
+	require.NoError(t, err)
+	require.Equal(t, int64(2), calls)
+}
+
+func TestRunReserved(t *testing.T) {
+	var calls int64
+	urls := workers(t, 2, &calls)
+
+	// Another coordinator has reserved the second worker
+	resp, err := http.Post(urls[1]+"/prepare", "application/json", strings.NewReader(`{"Tests": ["pass"]}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	c := distributed.NewCoordinator(urls, spidomtr.ShowSummary(false), spidomtr.Users(2))
+	_, err = c.Run(context.Background(), "pass")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "worker "+urls[1]+": 409 Conflict")
+	require.Zero(t, calls)
+
+	// A run without the reservation is refused
+	resp, err = http.Post(urls[1]+"/run", "application/json", strings.NewReader(`{"Tests": ["pass"]}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+func TestRunWorkerFails(t *testing.T) {
+	var calls int64
+	urls := workers(t, 1, &calls)
+
+	// A worker that accepts the job, but fails to run it
+	w := distributed.NewWorker(testunit.New(testunit.ID("pass")))
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/run" {
+			http.Error(rw, "out of memory", http.StatusInternalServerError)
+			return
+		}
+		w.ServeHTTP(rw, r)
+	}))
+	defer srv.Close()
+
+	h := &collector{}
+	c := distributed.NewCoordinator(append(urls, srv.URL),
+		spidomtr.Handlers(h),
+		spidomtr.Iterations(2),
+		spidomtr.ShowSummary(false),
+		spidomtr.Users(2),
+	)
+	res, err := c.Run(context.Background(), "pass")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "500 Internal Server Error: out of memory")
+
+	// The handlers are done with the result of the other worker
+	require.True(t, h.done)
+	require.LessOrEqual(t, res.Stats.Count, 2)
+	for _, n := range h.users {
+		require.Zero(t, n)
+	}
+}
+
+func TestRunMaxErrorClasses(t *testing.T) {
+	// The workers' most frequent errors differ from the total's
+	urls := make([]string, 2)
+	for i, classes := range [][]string{{"a", "x"}, {"b", "y"}} {
+		classes := classes
+		w := distributed.NewWorker(testunit.New(
+			testunit.ID("fail"),
+			testunit.Test(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+				switch i := testunit.Iteration(ctx); {
+				case i < 3:
+					return args, errors.New(classes[0])
+				case i < 5:
+					return args, errors.New("c")
+				}
+				return args, errors.New(classes[1])
+			}),
+		))
+		srv := httptest.NewServer(w)
+		t.Cleanup(srv.Close)
+		urls[i] = srv.URL
+	}
+
+	c := distributed.NewCoordinator(urls,
+		spidomtr.Iterations(6),
+		spidomtr.MaxErrorClasses(2),
+		spidomtr.ShowSummary(false),
+		spidomtr.Users(2),
+	)
+	res, err := c.Run(context.Background(), "fail")
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"c": 4, spidomtr.OtherErrors: 8}, res.Stats.Errorm)
+}
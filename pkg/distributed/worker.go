@@ -0,0 +1,253 @@
+package distributed
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+)
+
+// ReservationTimeout is how long a worker stays reserved for a job that
+// is not run, e.g. because the coordinator is gone
+const ReservationTimeout = 30 * time.Second
+
+// Worker runs jobs from a coordinator, one at a time. It serves the
+// protocol as an http.Handler:
+//
+//	POST /prepare checks that a job can be run, and reserves the worker
+//	POST /run     runs a reserved job at its start time, streaming the
+//	              test results back
+//	POST /release releases the worker from a job that is not run
+type Worker struct {
+	busy        bool
+	classifiers []spidomtr.ErrorClassifier
+	expires     time.Time
+	mu          sync.Mutex
+	reservation string
+	tests       map[string]testunit.TestUnit
+}
+
+// NewWorker constructs a new worker running tests
+func NewWorker(tests ...testunit.TestUnit) *Worker {
+	w := &Worker{tests: make(map[string]testunit.TestUnit)}
+	w.Register(tests...)
+	return w
+}
+
+// Register registers tests by their IDs, replacing tests with the same
+// IDs
+func (w *Worker) Register(tests ...testunit.TestUnit) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, t := range tests {
+		w.tests[t.ID()] = t
+	}
+}
+
+// ClassifyErrors sets the error classifiers of the jobs run, which
+// cannot be sent by the coordinator
+func (w *Worker) ClassifyErrors(c ...spidomtr.ErrorClassifier) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.classifiers = c
+}
+
+// ServeHTTP serves the worker protocol
+func (w *Worker) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var job Job
+	if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+		http.Error(rw, "invalid job: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	tests, err := w.lookup(job.Tests)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/prepare":
+		id, ok := w.reserve()
+		if !ok {
+			http.Error(rw, "busy running another job", http.StatusConflict)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(reservation{Reservation: id})
+	case "/run":
+		if !w.acquire(job.Reservation) {
+			http.Error(rw, "not reserved for the job", http.StatusConflict)
+			return
+		}
+		defer w.done()
+		w.run(rw, r, job, tests)
+	case "/release":
+		w.release(job.Reservation)
+		rw.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(rw, r)
+	}
+}
+
+func (w *Worker) run(rw http.ResponseWriter, r *http.Request, job Job, tests []testunit.TestUnit) {
+	rw.Header().Set("Content-Type", "application/x-ndjson")
+	rw.WriteHeader(http.StatusOK)
+
+	s := &stream{enc: json.NewEncoder(rw)}
+	s.flusher, _ = rw.(http.Flusher)
+	s.flush()
+
+	// Wait for the other workers, unless the start time has passed
+	if d := time.Until(job.Start); d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	w.mu.Lock()
+	classifiers := w.classifiers
+	w.mu.Unlock()
+
+	cfg := job.Config
+	runner := spidomtr.NewRunner(
+		spidomtr.Description(cfg.Description),
+		spidomtr.Duration(cfg.Duration),
+		spidomtr.ErrorClassifiers(classifiers...),
+		spidomtr.Handlers(s),
+		spidomtr.HistogramBuckets(cfg.HistogramBuckets),
+		spidomtr.ID(cfg.ID),
+		spidomtr.Iterations(cfg.Iterations),
+		// Errors are capped once joined by the coordinator
+		spidomtr.MaxErrorClasses(0),
+		spidomtr.Percentiles(cfg.Percentiles),
+		spidomtr.Rate(cfg.Rate),
+		spidomtr.ShowLogo(false),
+		spidomtr.ShowSummary(false),
+		spidomtr.Timeout(cfg.Timeout),
+		spidomtr.TotalIterations(cfg.TotalIterations),
+		spidomtr.Users(cfg.Users),
+	)
+	res := runner.Run(r.Context(), tests...)
+	s.send(message{Result: &res})
+}
+
+func (w *Worker) lookup(ids []string) ([]testunit.TestUnit, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no tests")
+	}
+	tests := make([]testunit.TestUnit, 0, len(ids))
+	for _, id := range ids {
+		t, ok := w.tests[id]
+		if !ok {
+			return nil, fmt.Errorf("unknown test %q", id)
+		}
+		tests = append(tests, t)
+	}
+	return tests, nil
+}
+
+// reserve reserves the worker for a job, unless it is running or
+// reserved for another job
+func (w *Worker) reserve() (string, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.busy || (w.reservation != "" && time.Now().Before(w.expires)) {
+		return "", false
+	}
+	w.reservation = uuid.NewString()
+	w.expires = time.Now().Add(ReservationTimeout)
+	return w.reservation, true
+}
+
+// acquire starts running the job with the reservation
+func (w *Worker) acquire(reservation string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.busy || reservation == "" || reservation != w.reservation || !time.Now().Before(w.expires) {
+		return false
+	}
+	w.busy = true
+	w.reservation = ""
+	return true
+}
+
+// release releases the reservation, if the worker still has it
+func (w *Worker) release(reservation string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if reservation != "" && reservation == w.reservation {
+		w.reservation = ""
+	}
+}
+
+func (w *Worker) done() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.busy = false
+}
+
+// stream is a runner handler streaming test results to the coordinator
+type stream struct {
+	enc     *json.Encoder
+	flusher http.Flusher
+	mu      sync.Mutex
+}
+
+// RunnerStarted is called when runner is started (prior to any tests
+// have been run).
+func (s *stream) RunnerStarted(id, description string, count int) {}
+
+// UserStarted is called when a user starts running tests.
+func (s *stream) UserStarted(user int) {
+	s.send(message{UserStarted: &user})
+}
+
+// UserDone is called when a user has run all its tests.
+func (s *stream) UserDone(user int) {
+	s.send(message{UserDone: &user})
+}
+
+// TestStarted is called right before a test is run.
+func (s *stream) TestStarted(id string, user, iteration int) {
+	s.send(message{TestStarted: &testStarted{ID: id, Iteration: iteration, User: user}})
+}
+
+// TestDone is called when a test has been completed.
+func (s *stream) TestDone(res spidomtr.TestResult) {
+	s.send(message{Test: &res})
+}
+
+// RunnerDone is called when the runner has run all tests.
+func (s *stream) RunnerDone(res spidomtr.Result) {}
+
+func (s *stream) send(msg message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// A failed write means the coordinator is gone, which cancels the
+	// request context and so the run
+	if err := s.enc.Encode(msg); err == nil {
+		s.flush()
+	}
+}
+
+func (s *stream) flush() {
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+}
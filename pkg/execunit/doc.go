@@ -0,0 +1,2 @@
+// Package execunit builds spidomtr test units from external commands
+package execunit
@@ -0,0 +1,231 @@
+package execunit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+)
+
+// Counters and timings reported for each iteration
+const (
+	// ExitCounterPrefix prefixes the counter of each exit code, e.g.
+	// "exec.exit.0"
+	ExitCounterPrefix = "exec.exit."
+	// MaxRSSCounter sums the max resident set size in kilobytes of the
+	// commands (unix only)
+	MaxRSSCounter = "exec.max_rss_kb"
+	// UserCPUTiming is the user CPU time of the command
+	UserCPUTiming = "exec.cpu.user"
+	// SystemCPUTiming is the system CPU time of the command
+	SystemCPUTiming = "exec.cpu.system"
+)
+
+// maxOutput is the max number of output bytes included in errors
+const maxOutput = 1024
+
+// Data is the data the command args and env templates are executed
+// with
+type Data struct {
+	ID        string
+	Iteration int
+	User      int
+}
+
+// Config type
+type Config struct {
+	Dir          string
+	Enabled      func() (bool, string)
+	Env          map[string]string
+	FailOnStderr []*regexp.Regexp
+	ID           string
+	Stdin        []byte
+	WaitDelay    time.Duration
+}
+
+// Option type
+type Option func(*Config)
+
+// Dir sets the working directory of the command
+func Dir(dir string) Option {
+	return func(cfg *Config) {
+		cfg.Dir = dir
+	}
+}
+
+// Enabled adds enabled func
+func Enabled(f func() (bool, string)) Option {
+	return func(cfg *Config) {
+		cfg.Enabled = f
+	}
+}
+
+// Env adds an environment variable, in addition to the environment of
+// the current process. The value is a text/template executed with
+// Data.
+func Env(key, value string) Option {
+	return func(cfg *Config) {
+		cfg.Env[key] = value
+	}
+}
+
+// FailOnStderr fails the test if stderr matches the regular expression
+// pattern, even if the command exits with code 0
+func FailOnStderr(pattern string) Option {
+	return func(cfg *Config) {
+		cfg.FailOnStderr = append(cfg.FailOnStderr, regexp.MustCompile(pattern))
+	}
+}
+
+// ID sets the test unit id (defaults to the command name)
+func ID(id string) Option {
+	return func(cfg *Config) {
+		cfg.ID = id
+	}
+}
+
+// Stdin sets the input of the command
+func Stdin(b []byte) Option {
+	return func(cfg *Config) {
+		cfg.Stdin = b
+	}
+}
+
+// WaitDelay sets how long to wait for the output of a killed command
+// to be closed (defaults to 1 sec)
+func WaitDelay(d time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.WaitDelay = d
+	}
+}
+
+// New constructs a test unit executing the command name with args. The
+// args and env values are text/templates executed with Data, e.g.
+// "--user={{.User}}". The command fails the test if it exits with a
+// non-zero code, with its output in the error. When the test times
+// out, the process group of the command is killed. Exit codes and CPU
+// and memory usage are reported in the test result.
+func New(name string, args []string, options ...Option) *testunit.TestAssembly {
+	cfg := &Config{
+		Enabled:   func() (bool, string) { return true, "" },
+		Env:       make(map[string]string),
+		ID:        name,
+		WaitDelay: time.Second,
+	}
+
+	for _, opt := range options {
+		opt(cfg)
+	}
+
+	argTmpls := make([]*template.Template, len(args))
+	for i, arg := range args {
+		argTmpls[i] = template.Must(template.New("arg").Parse(arg))
+	}
+	envTmpls := make(map[string]*template.Template, len(cfg.Env))
+	for k, v := range cfg.Env {
+		envTmpls[k] = template.Must(template.New(k).Parse(v))
+	}
+
+	return testunit.New(
+		testunit.ID(cfg.ID),
+		testunit.Enabled(cfg.Enabled),
+		testunit.Test(func(ctx context.Context, targs []interface{}) ([]interface{}, error) {
+			data := Data{
+				ID:        cfg.ID,
+				Iteration: testunit.Iteration(ctx),
+				User:      testunit.User(ctx),
+			}
+
+			cmdArgs := make([]string, len(argTmpls))
+			for i, tmpl := range argTmpls {
+				s, err := execute(tmpl, data)
+				if err != nil {
+					return targs, err
+				}
+				cmdArgs[i] = s
+			}
+
+			env := os.Environ()
+			for k, tmpl := range envTmpls {
+				s, err := execute(tmpl, data)
+				if err != nil {
+					return targs, err
+				}
+				env = append(env, k+"="+s)
+			}
+
+			return targs, run(ctx, cfg, name, cmdArgs, env)
+		}),
+	)
+}
+
+func execute(tmpl *template.Template, data Data) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func run(ctx context.Context, cfg *Config, name string, args, env []string) error {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = cfg.Dir
+	cmd.Env = env
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = cfg.WaitDelay
+	if cfg.Stdin != nil {
+		cmd.Stdin = bytes.NewReader(cfg.Stdin)
+	}
+	setProcessGroup(cmd)
+
+	err := cmd.Run()
+	if cmd.ProcessState != nil {
+		testunit.Count(ctx, ExitCounterPrefix+strconv.Itoa(cmd.ProcessState.ExitCode()), 1)
+		testunit.Timing(ctx, UserCPUTiming, cmd.ProcessState.UserTime())
+		testunit.Timing(ctx, SystemCPUTiming, cmd.ProcessState.SystemTime())
+		recordRusage(testunit.RecorderFromContext(ctx), cmd)
+	}
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%v: %v", ctx.Err(), err)
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return outputError(err.Error(), stderr.Bytes(), stdout.Bytes())
+		}
+		return err
+	}
+
+	for _, re := range cfg.FailOnStderr {
+		if re.Match(stderr.Bytes()) {
+			return outputError("stderr matches "+strconv.Quote(re.String()), stderr.Bytes(), nil)
+		}
+	}
+	return nil
+}
+
+func outputError(msg string, outputs ...[]byte) error {
+	for _, out := range outputs {
+		out = bytes.TrimSpace(out)
+		if len(out) == 0 {
+			continue
+		}
+		if len(out) > maxOutput {
+			out = append(out[:maxOutput:maxOutput], "..."...)
+		}
+		return errors.New(msg + ": " + string(out))
+	}
+	return errors.New(msg)
+}
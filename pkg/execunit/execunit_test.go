@@ -0,0 +1,68 @@
+//go:build unix
+
+package execunit_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/execunit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecUnit(t *testing.T) {
+	t.Run("exit codes and output", func(t *testing.T) {
+		pass := execunit.New("sh", []string{"-c", `test "$GREETING" = "hello {{.User}}" && echo "{{.ID}} {{.Iteration}}"`},
+			execunit.ID("pass"),
+			execunit.Env("GREETING", "hello {{.User}}"),
+		)
+		fail := execunit.New("sh", []string{"-c", "echo boom >&2; exit 3"},
+			execunit.ID("fail"),
+		)
+		warn := execunit.New("sh", []string{"-c", "echo warning: deprecated >&2"},
+			execunit.ID("warn"),
+			execunit.FailOnStderr("^warning"),
+		)
+
+		runner := spidomtr.NewRunner(
+			spidomtr.Iterations(3),
+			spidomtr.ShowLogo(false),
+			spidomtr.ShowSummary(false),
+			spidomtr.Users(2),
+		)
+		res := runner.Run(context.Background(), pass, fail, warn)
+
+		passStats := res.TestStats["pass"].Stats
+		require.Equal(t, 6, passStats.Passed, passStats.Errorm)
+		require.Equal(t, int64(6), passStats.Counters[execunit.ExitCounterPrefix+"0"])
+		require.Equal(t, 6, passStats.Phases[execunit.UserCPUTiming].Count)
+		require.Greater(t, passStats.Counters[execunit.MaxRSSCounter], int64(0))
+
+		require.Equal(t, map[string]int{"exit status 3: boom": 6}, res.TestStats["fail"].Stats.Errorm)
+		require.Equal(t, int64(6), res.Stats.Counters[execunit.ExitCounterPrefix+"3"])
+
+		require.Equal(t, map[string]int{`stderr matches "^warning": warning: deprecated`: 6}, res.TestStats["warn"].Stats.Errorm)
+	})
+	t.Run("timeout kills process group", func(t *testing.T) {
+		test := execunit.New("sh", []string{"-c", "sleep 10 & sleep 10; wait"},
+			execunit.ID("sleepy"),
+		)
+
+		runner := spidomtr.NewRunner(
+			spidomtr.ShowLogo(false),
+			spidomtr.ShowSummary(false),
+			spidomtr.Timeout(100*time.Millisecond),
+		)
+
+		start := time.Now()
+		res := runner.Run(context.Background(), test)
+		require.Less(t, int64(time.Since(start)), int64(5*time.Second))
+		require.Equal(t, 1, res.Stats.Errors)
+		for err := range res.Stats.Errorm {
+			require.True(t, strings.HasPrefix(err, "context deadline exceeded"), err)
+		}
+	})
+}
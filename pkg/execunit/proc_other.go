@@ -0,0 +1,16 @@
+//go:build !unix
+
+package execunit
+
+import (
+	"os/exec"
+
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+)
+
+// setProcessGroup kills only the command itself when the context is
+// done, as process groups are not supported.
+func setProcessGroup(*exec.Cmd) {}
+
+// recordRusage does nothing, as resource usage is not supported.
+func recordRusage(*testunit.Recorder, *exec.Cmd) {}
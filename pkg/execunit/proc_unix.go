@@ -0,0 +1,29 @@
+//go:build unix
+
+package execunit
+
+import (
+	"os/exec"
+	"syscall"
+
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+)
+
+// setProcessGroup starts the command in its own process group, and
+// kills the whole group when the context is done.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// recordRusage counts the max resident set size of the command.
+func recordRusage(rec *testunit.Recorder, cmd *exec.Cmd) {
+	if rec == nil {
+		return
+	}
+	if ru, ok := cmd.ProcessState.SysUsage().(*syscall.Rusage); ok {
+		rec.Count(MaxRSSCounter, maxRSS(ru))
+	}
+}
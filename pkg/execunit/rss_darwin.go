@@ -0,0 +1,9 @@
+package execunit
+
+import "syscall"
+
+// maxRSS returns max resident set size in kilobytes. Darwin reports
+// it in bytes.
+func maxRSS(ru *syscall.Rusage) int64 {
+	return ru.Maxrss / 1024
+}
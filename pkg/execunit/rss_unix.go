@@ -0,0 +1,10 @@
+//go:build unix && !darwin
+
+package execunit
+
+import "syscall"
+
+// maxRSS returns max resident set size in kilobytes.
+func maxRSS(ru *syscall.Rusage) int64 {
+	return int64(ru.Maxrss)
+}
@@ -0,0 +1,214 @@
+// Package feeder feeds spidomtr tests with a data record per iteration,
+// e.g. user credentials or product IDs, read from a slice, a CSV file,
+// a JSON Lines file or a generator func
+package feeder
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+)
+
+// Strategy decides which record is fed to an iteration
+type Strategy int
+
+const (
+	// Sequential feeds each user the records in order, starting over
+	// when they run out, so iteration i gets record i.
+	Sequential Strategy = iota
+	// Random feeds a random record to each iteration.
+	Random
+	// Circular feeds the records in order across all users, starting
+	// over when they run out.
+	Circular
+	// UniquePerUser feeds each user a record of its own, i.e. user i
+	// gets record i in all its iterations. Users without a record fail.
+	UniquePerUser
+	// ExhaustThenStop feeds the records in order across all users, each
+	// record only once. A user stops once the records have run out, and
+	// the iteration that found them exhausted is skipped.
+	ExhaustThenStop
+)
+
+func (s Strategy) String() string {
+	switch s {
+	case Sequential:
+		return "sequential"
+	case Random:
+		return "random"
+	case Circular:
+		return "circular"
+	case UniquePerUser:
+		return "unique-per-user"
+	case ExhaustThenStop:
+		return "exhaust-then-stop"
+	}
+	return fmt.Sprintf("strategy(%d)", int(s))
+}
+
+// Feeder feeds records to a test, see testunit.Feed
+type Feeder struct {
+	gen      func(ctx context.Context, i int) (interface{}, error)
+	mu       sync.Mutex
+	next     int
+	rand     *rand.Rand
+	records  []interface{}
+	strategy Strategy
+}
+
+// Slice constructs a feeder of the records in a slice
+func Slice[T any](records []T, strategy Strategy) *Feeder {
+	rs := make([]interface{}, len(records))
+	for i, r := range records {
+		rs[i] = r
+	}
+	return newFeeder(rs, strategy)
+}
+
+// CSV constructs a feeder of the rows of CSV data. The first row is the
+// header, and each record is a map[string]string of the columns of a
+// row.
+func CSV(r io.Reader, strategy Strategy) (*Feeder, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("feeder: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("feeder: csv header missing")
+	}
+
+	header := rows[0]
+	records := make([]interface{}, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		record := make(map[string]string, len(header))
+		for i, col := range header {
+			record[col] = row[i]
+		}
+		records = append(records, record)
+	}
+	return newFeeder(records, strategy), nil
+}
+
+// CSVFile constructs a feeder of the rows of a CSV file, see CSV
+func CSVFile(name string, strategy Strategy) (*Feeder, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("feeder: %w", err)
+	}
+	defer f.Close()
+	return CSV(f, strategy)
+}
+
+// JSONL constructs a feeder of the lines of JSON Lines data. Each
+// record is the decoded JSON value of a line, e.g. a
+// map[string]interface{} for an object. Blank lines are ignored.
+func JSONL(r io.Reader, strategy Strategy) (*Feeder, error) {
+	var records []interface{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		b := bytes.TrimSpace(scanner.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		var record interface{}
+		if err := json.Unmarshal(b, &record); err != nil {
+			return nil, fmt.Errorf("feeder: line %d: %w", line, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("feeder: %w", err)
+	}
+	return newFeeder(records, strategy), nil
+}
+
+// JSONLFile constructs a feeder of the lines of a JSON Lines file, see
+// JSONL
+func JSONLFile(name string, strategy Strategy) (*Feeder, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("feeder: %w", err)
+	}
+	defer f.Close()
+	return JSONL(f, strategy)
+}
+
+// Generator constructs a feeder of records generated by f, which is
+// called with a sequence number counting the records fed across all
+// users. It may return testunit.ErrExhausted to stop feeding.
+func Generator(f func(ctx context.Context, i int) (interface{}, error)) *Feeder {
+	return &Feeder{gen: f}
+}
+
+func newFeeder(records []interface{}, strategy Strategy) *Feeder {
+	return &Feeder{
+		rand:     rand.New(rand.NewSource(rand.Int63())),
+		records:  records,
+		strategy: strategy,
+	}
+}
+
+// Len returns the number of records, or -1 for a generator
+func (f *Feeder) Len() int {
+	if f.gen != nil {
+		return -1
+	}
+	return len(f.records)
+}
+
+// Next returns the record for the test run ctx belongs to
+func (f *Feeder) Next(ctx context.Context) (interface{}, error) {
+	if f.gen != nil {
+		f.mu.Lock()
+		i := f.next
+		f.next++
+		f.mu.Unlock()
+		return f.gen(ctx, i)
+	}
+
+	n := len(f.records)
+	if n == 0 {
+		return nil, testunit.ErrExhausted
+	}
+
+	switch f.strategy {
+	case Sequential:
+		return f.records[testunit.Iteration(ctx)%n], nil
+	case Random:
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return f.records[f.rand.Intn(n)], nil
+	case Circular:
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		record := f.records[f.next%n]
+		f.next++
+		return record, nil
+	case UniquePerUser:
+		user := testunit.User(ctx)
+		if user >= n {
+			return nil, fmt.Errorf("feeder: no record for user %d of %d records", user, n)
+		}
+		return f.records[user], nil
+	case ExhaustThenStop:
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.next >= n {
+			return nil, testunit.ErrExhausted
+		}
+		record := f.records[f.next]
+		f.next++
+		return record, nil
+	}
+	return nil, fmt.Errorf("feeder: unknown %s", f.strategy)
+}
@@ -0,0 +1,164 @@
+package feeder_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/feeder"
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+	"github.com/stretchr/testify/require"
+)
+
+func run(f testunit.Feeder, users, iterations int) spidomtr.Result {
+	test := testunit.New(
+		testunit.ID("fed"),
+		testunit.Feed(f),
+		testunit.Test(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			if testunit.Record(ctx) == "fail" {
+				return args, errors.New("whooops")
+			}
+			return args, nil
+		}),
+	)
+	runner := spidomtr.NewRunner(
+		spidomtr.Iterations(iterations),
+		spidomtr.ShowLogo(false),
+		spidomtr.ShowSummary(false),
+		spidomtr.Users(users),
+	)
+	return runner.Run(context.Background(), test)
+}
+
+func records(res spidomtr.Result, user int) []interface{} {
+	var rs []interface{}
+	for _, tr := range res.TestStats["fed"].TestResults {
+		if tr.User == user && tr.Outcome != testunit.Skip {
+			rs = append(rs, tr.Record)
+		}
+	}
+	return rs
+}
+
+func TestStrategies(t *testing.T) {
+	letters := []string{"a", "b", "c"}
+
+	res := run(feeder.Slice(letters, feeder.Sequential), 2, 4)
+	require.Equal(t, []interface{}{"a", "b", "c", "a"}, records(res, 0))
+	require.Equal(t, []interface{}{"a", "b", "c", "a"}, records(res, 1))
+
+	res = run(feeder.Slice(letters, feeder.UniquePerUser), 3, 2)
+	for user := 0; user < 3; user++ {
+		require.Equal(t, []interface{}{letters[user], letters[user]}, records(res, user))
+	}
+	res = run(feeder.Slice(letters, feeder.UniquePerUser), 4, 1)
+	require.Equal(t, 1, res.Stats.Errors)
+
+	res = run(feeder.Slice(letters, feeder.Circular), 2, 3)
+	var all []string
+	for _, tr := range res.TestStats["fed"].TestResults {
+		all = append(all, tr.Record.(string))
+	}
+	sort.Strings(all)
+	require.Equal(t, []string{"a", "a", "b", "b", "c", "c"}, all)
+
+	res = run(feeder.Slice(letters, feeder.ExhaustThenStop), 2, 5)
+	require.Equal(t, 3, res.Stats.Passed)
+	require.Equal(t, 2, res.Stats.Skips)
+	for _, tr := range res.TestStats["fed"].TestResults {
+		if tr.Outcome == testunit.Skip {
+			require.Equal(t, "feeder exhausted", tr.Comment)
+			require.Nil(t, tr.Record)
+		}
+	}
+
+	res = run(feeder.Slice(letters, feeder.Random), 1, 20)
+	for _, r := range records(res, 0) {
+		require.Contains(t, letters, r)
+	}
+
+	res = run(feeder.Slice([]string{"ok", "fail"}, feeder.Sequential), 1, 4)
+	require.Equal(t, 2, res.Stats.Errors)
+	for _, tr := range res.TestStats["fed"].TestResults {
+		require.Equal(t, tr.Record == "fail", tr.Outcome == testunit.Fail)
+	}
+}
+
+func TestCSV(t *testing.T) {
+	f, err := feeder.CSV(strings.NewReader("user,password\nalice,secret\nbob,hunter2\n"), feeder.Sequential)
+	require.NoError(t, err)
+	require.Equal(t, 2, f.Len())
+
+	res := run(f, 1, 2)
+	require.Equal(t, []interface{}{
+		map[string]string{"user": "alice", "password": "secret"},
+		map[string]string{"user": "bob", "password": "hunter2"},
+	}, records(res, 0))
+
+	_, err = feeder.CSV(strings.NewReader(""), feeder.Sequential)
+	require.Error(t, err)
+	_, err = feeder.CSV(strings.NewReader("a,b\n1\n"), feeder.Sequential)
+	require.Error(t, err)
+	_, err = feeder.CSVFile("missing.csv", feeder.Sequential)
+	require.Error(t, err)
+}
+
+func TestJSONL(t *testing.T) {
+	f, err := feeder.JSONL(strings.NewReader("{\"id\": 1}\n\n{\"id\": 2}\n"), feeder.Sequential)
+	require.NoError(t, err)
+	require.Equal(t, 2, f.Len())
+
+	res := run(f, 1, 2)
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"id": float64(1)},
+		map[string]interface{}{"id": float64(2)},
+	}, records(res, 0))
+
+	_, err = feeder.JSONL(strings.NewReader("{\"id\": 1}\n{id}\n"), feeder.Sequential)
+	require.EqualError(t, err, "feeder: line 2: invalid character 'i' looking for beginning of object key string")
+}
+
+func TestGenerator(t *testing.T) {
+	f := feeder.Generator(func(ctx context.Context, i int) (interface{}, error) {
+		if i >= 5 {
+			return nil, testunit.ErrExhausted
+		}
+		return fmt.Sprintf("product-%d", i), nil
+	})
+	require.Equal(t, -1, f.Len())
+
+	res := run(f, 1, 8)
+	require.Equal(t, 5, res.Stats.Passed)
+	require.Equal(t, 1, res.Stats.Skips)
+	require.Equal(t, []interface{}{"product-0", "product-1", "product-2", "product-3", "product-4"}, records(res, 0))
+}
+
+func TestExhaustThenStopDuration(t *testing.T) {
+	test := testunit.New(
+		testunit.ID("fed"),
+		testunit.Feed(feeder.Slice([]string{"a", "b", "c"}, feeder.ExhaustThenStop)),
+		testunit.Test(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			return args, nil
+		}),
+	)
+	runner := spidomtr.NewRunner(
+		spidomtr.Duration(200*time.Millisecond),
+		spidomtr.ShowLogo(false),
+		spidomtr.ShowSummary(false),
+		spidomtr.Users(2),
+	)
+	start := time.Now()
+	res := runner.Run(context.Background(), test)
+
+	// Each user stops on the first exhausted iteration, long before the
+	// duration has passed
+	require.Equal(t, 3, res.Stats.Passed)
+	require.Equal(t, 2, res.Stats.Skips)
+	require.Equal(t, 5, res.Stats.Count)
+	require.Less(t, time.Since(start), 200*time.Millisecond)
+}
@@ -0,0 +1,3 @@
+// Package grpcunit builds spidomtr test units from gRPC method
+// invocations
+package grpcunit
@@ -0,0 +1,339 @@
+package grpcunit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Counters and timings reported for each invocation
+const (
+	// MessagesCounter counts received response messages
+	MessagesCounter = "grpc.messages"
+	// StatusCounterPrefix prefixes the counter of each status code,
+	// e.g. "grpc.status.OK"
+	StatusCounterPrefix = "grpc.status."
+	// FirstMessageTiming is the time until the first message of a
+	// stream is received
+	FirstMessageTiming = "grpc.first_message"
+	// StreamTiming is the time until a stream is done
+	StreamTiming = "grpc.stream"
+)
+
+// ConnMode type
+type ConnMode int
+
+const (
+	// SharedConn shares one connection between all users
+	SharedConn ConnMode = 0
+	// PerUserConn dials one connection per simulated user
+	PerUserConn ConnMode = 1
+)
+
+// RequestFunc returns the request message of an iteration
+type RequestFunc func(ctx context.Context) (proto.Message, error)
+
+// Config type
+type Config struct {
+	CallOptions  []grpc.CallOption
+	Conn         *grpc.ClientConn
+	ConnMode     ConnMode
+	DialOptions  []grpc.DialOption
+	Enabled      func() (bool, string)
+	ID           string
+	MaxMessages  int
+	Metadata     metadata.MD
+	MetadataFunc func(context.Context) metadata.MD
+	OKCodes      []codes.Code
+	Target       string
+	Validate     func(proto.Message) error
+}
+
+// Option type
+type Option func(*Config)
+
+// CallOptions sets options used for each invocation
+func CallOptions(opts ...grpc.CallOption) Option {
+	return func(cfg *Config) {
+		cfg.CallOptions = opts
+	}
+}
+
+// Conn sets a connection shared by all users. The connection is not
+// closed by the test unit.
+func Conn(conn *grpc.ClientConn) Option {
+	return func(cfg *Config) {
+		cfg.Conn = conn
+	}
+}
+
+// Enabled adds enabled func
+func Enabled(f func() (bool, string)) Option {
+	return func(cfg *Config) {
+		cfg.Enabled = f
+	}
+}
+
+// ID sets the test unit id (defaults to the method name)
+func ID(id string) Option {
+	return func(cfg *Config) {
+		cfg.ID = id
+	}
+}
+
+// MaxMessages stops reading a server stream after n messages (defaults
+// to reading until the server closes the stream)
+func MaxMessages(n int) Option {
+	return func(cfg *Config) {
+		cfg.MaxMessages = n
+	}
+}
+
+// Metadata adds outgoing metadata sent with each invocation
+func Metadata(key, value string) Option {
+	return func(cfg *Config) {
+		cfg.Metadata.Append(key, value)
+	}
+}
+
+// MetadataFunc adds a func returning outgoing metadata for each
+// invocation
+func MetadataFunc(f func(context.Context) metadata.MD) Option {
+	return func(cfg *Config) {
+		cfg.MetadataFunc = f
+	}
+}
+
+// OK sets the status codes that pass the test (defaults to codes.OK)
+func OK(c ...codes.Code) Option {
+	return func(cfg *Config) {
+		cfg.OKCodes = c
+	}
+}
+
+// Target sets the target to dial, and the connection mode
+func Target(target string, mode ConnMode, opts ...grpc.DialOption) Option {
+	return func(cfg *Config) {
+		cfg.Target = target
+		cfg.ConnMode = mode
+		cfg.DialOptions = opts
+	}
+}
+
+// Validate adds a func validating each response message
+func Validate(f func(proto.Message) error) Option {
+	return func(cfg *Config) {
+		cfg.Validate = f
+	}
+}
+
+// Unit is a test unit invoking a gRPC method
+type Unit struct {
+	*testunit.TestAssembly
+	cfg   *Config
+	mu    sync.Mutex
+	conns map[int]*grpc.ClientConn
+}
+
+func newUnit(method string, options []Option) *Unit {
+	cfg := &Config{
+		Enabled:  func() (bool, string) { return true, "" },
+		ID:       method,
+		Metadata: metadata.MD{},
+		OKCodes:  []codes.Code{codes.OK},
+	}
+
+	for _, opt := range options {
+		opt(cfg)
+	}
+
+	return &Unit{
+		cfg:   cfg,
+		conns: make(map[int]*grpc.ClientConn),
+	}
+}
+
+// Unary constructs a test unit invoking a unary method, e.g.
+// "/grpc.health.v1.Health/Check". A new request is created by request
+// for each iteration, and response returns an empty response message.
+func Unary(method string, request RequestFunc, response func() proto.Message, options ...Option) *Unit {
+	u := newUnit(method, options)
+	u.TestAssembly = testunit.New(
+		testunit.ID(u.cfg.ID),
+		testunit.Enabled(u.cfg.Enabled),
+		testunit.Test(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			conn, req, err := u.prepare(ctx, request)
+			if err != nil {
+				return args, err
+			}
+
+			resp := response()
+			err = conn.Invoke(u.outgoing(ctx), method, req, resp, u.cfg.CallOptions...)
+			if err == nil {
+				testunit.Count(ctx, MessagesCounter, 1)
+				if u.cfg.Validate != nil {
+					if err := u.cfg.Validate(resp); err != nil {
+						u.classify(ctx, nil)
+						return args, err
+					}
+				}
+			}
+			return args, u.classify(ctx, err)
+		}),
+	)
+	return u
+}
+
+// ServerStream constructs a test unit invoking a server streaming
+// method. A new request is created by request for each iteration, and
+// response returns an empty response message. The number of received
+// messages, the time to the first message and the stream duration are
+// reported in the test result.
+func ServerStream(method string, request RequestFunc, response func() proto.Message, options ...Option) *Unit {
+	u := newUnit(method, options)
+	desc := &grpc.StreamDesc{StreamName: method, ServerStreams: true}
+	u.TestAssembly = testunit.New(
+		testunit.ID(u.cfg.ID),
+		testunit.Enabled(u.cfg.Enabled),
+		testunit.Test(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			conn, req, err := u.prepare(ctx, request)
+			if err != nil {
+				return args, err
+			}
+
+			sctx, cancel := context.WithCancel(u.outgoing(ctx))
+			defer cancel()
+
+			start := time.Now()
+			stream, err := conn.NewStream(sctx, desc, method, u.cfg.CallOptions...)
+			if err != nil {
+				return args, u.classify(ctx, err)
+			}
+			if err := stream.SendMsg(req); err != nil {
+				return args, u.classify(ctx, err)
+			}
+			if err := stream.CloseSend(); err != nil {
+				return args, u.classify(ctx, err)
+			}
+
+			var n int
+			for u.cfg.MaxMessages <= 0 || n < u.cfg.MaxMessages {
+				resp := response()
+				err = stream.RecvMsg(resp)
+				if err == io.EOF {
+					err = nil
+					break
+				}
+				if err != nil {
+					break
+				}
+				if n == 0 {
+					testunit.Timing(ctx, FirstMessageTiming, time.Since(start))
+				}
+				n++
+				testunit.Count(ctx, MessagesCounter, 1)
+				if u.cfg.Validate != nil {
+					if err := u.cfg.Validate(resp); err != nil {
+						u.classify(ctx, nil)
+						return args, err
+					}
+				}
+			}
+			testunit.Timing(ctx, StreamTiming, time.Since(start))
+			return args, u.classify(ctx, err)
+		}),
+	)
+	return u
+}
+
+// Close closes the connections dialed by the test unit.
+func (u *Unit) Close() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var errs []error
+	for user, conn := range u.conns {
+		if err := conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(u.conns, user)
+	}
+	return errors.Join(errs...)
+}
+
+func (u *Unit) prepare(ctx context.Context, request RequestFunc) (*grpc.ClientConn, proto.Message, error) {
+	conn, err := u.conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := request(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, req, nil
+}
+
+func (u *Unit) conn(ctx context.Context) (*grpc.ClientConn, error) {
+	if u.cfg.Conn != nil {
+		return u.cfg.Conn, nil
+	}
+	if u.cfg.Target == "" {
+		return nil, errors.New("grpcunit: no connection or target")
+	}
+
+	var user int
+	if u.cfg.ConnMode == PerUserConn {
+		user = testunit.User(ctx)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	conn, ok := u.conns[user]
+	if ok {
+		return conn, nil
+	}
+	conn, err := grpc.NewClient(u.cfg.Target, u.cfg.DialOptions...)
+	if err != nil {
+		return nil, err
+	}
+	u.conns[user] = conn
+	return conn, nil
+}
+
+func (u *Unit) outgoing(ctx context.Context) context.Context {
+	md := u.cfg.Metadata
+	if u.cfg.MetadataFunc != nil {
+		md = metadata.Join(md, u.cfg.MetadataFunc(ctx))
+	}
+	if len(md) == 0 {
+		return ctx
+	}
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// classify counts the status code of err, and returns nil if it is one
+// of the codes that pass the test
+func (u *Unit) classify(ctx context.Context, err error) error {
+	code := status.Code(err)
+	testunit.Count(ctx, StatusCounterPrefix+code.String(), 1)
+	for _, c := range u.cfg.OKCodes {
+		if code == c {
+			return nil
+		}
+	}
+	if err == nil {
+		// status.Error(codes.OK, ...) is nil
+		return fmt.Errorf("unexpected status %s", code)
+	}
+	return err
+}
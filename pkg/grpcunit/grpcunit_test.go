@@ -0,0 +1,166 @@
+package grpcunit_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/grpcunit"
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+type countingListener struct {
+	*bufconn.Listener
+	mu    sync.Mutex
+	conns int
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.mu.Lock()
+		l.conns++
+		l.mu.Unlock()
+	}
+	return conn, err
+}
+
+type server struct {
+	lis *countingListener
+	mu  sync.Mutex
+	md  []string
+}
+
+func newServer(t *testing.T) *server {
+	s := &server{lis: &countingListener{Listener: bufconn.Listen(1024 * 1024)}}
+
+	gs := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		s.mu.Lock()
+		s.md = append(s.md, md.Get("x-user")...)
+		s.mu.Unlock()
+		return handler(ctx, req)
+	}))
+	hs := health.NewServer()
+	hs.SetServingStatus("svc", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(gs, hs)
+	go gs.Serve(s.lis)
+	t.Cleanup(gs.Stop)
+
+	return s
+}
+
+func (s *server) dialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return s.lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+}
+
+func checkRequest(service string) grpcunit.RequestFunc {
+	return func(context.Context) (proto.Message, error) {
+		return &healthpb.HealthCheckRequest{Service: service}, nil
+	}
+}
+
+func checkResponse() proto.Message {
+	return &healthpb.HealthCheckResponse{}
+}
+
+func run(users int, tests ...testunit.TestUnit) spidomtr.Result {
+	runner := spidomtr.NewRunner(
+		spidomtr.Iterations(10),
+		spidomtr.ShowLogo(false),
+		spidomtr.ShowSummary(false),
+		spidomtr.Users(users),
+	)
+	return runner.Run(context.Background(), tests...)
+}
+
+func TestUnary(t *testing.T) {
+	s := newServer(t)
+	conn, err := grpc.NewClient("passthrough:///bufnet", s.dialOptions()...)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	serving := grpcunit.Unary(healthpb.Health_Check_FullMethodName, checkRequest("svc"), checkResponse,
+		grpcunit.Conn(conn),
+		grpcunit.ID("serving"),
+		grpcunit.MetadataFunc(func(ctx context.Context) metadata.MD {
+			return metadata.Pairs("x-user", fmt.Sprint(testunit.User(ctx)))
+		}),
+		grpcunit.Validate(func(m proto.Message) error {
+			if m.(*healthpb.HealthCheckResponse).Status != healthpb.HealthCheckResponse_SERVING {
+				return fmt.Errorf("not serving")
+			}
+			return nil
+		}),
+	)
+	unknown := grpcunit.Unary(healthpb.Health_Check_FullMethodName, checkRequest("unknown"), checkResponse,
+		grpcunit.Conn(conn),
+		grpcunit.ID("unknown"),
+	)
+	notFound := grpcunit.Unary(healthpb.Health_Check_FullMethodName, checkRequest("unknown"), checkResponse,
+		grpcunit.Conn(conn),
+		grpcunit.ID("not found"),
+		grpcunit.OK(codes.NotFound),
+	)
+	unexpectedOK := grpcunit.Unary(healthpb.Health_Check_FullMethodName, checkRequest("svc"), checkResponse,
+		grpcunit.Conn(conn),
+		grpcunit.ID("unexpected ok"),
+		grpcunit.OK(codes.NotFound),
+	)
+
+	res := run(2, serving, unknown, notFound, unexpectedOK)
+	require.Equal(t, 20, res.TestStats["serving"].Stats.Passed)
+	require.Equal(t, int64(20), res.TestStats["serving"].Stats.Counters[grpcunit.MessagesCounter])
+	require.Equal(t, int64(20), res.TestStats["serving"].Stats.Counters[grpcunit.StatusCounterPrefix+"OK"])
+	require.Equal(t, 20, res.TestStats["unknown"].Stats.Errors)
+	require.Equal(t, 20, res.TestStats["not found"].Stats.Passed)
+	require.Equal(t, map[string]int{"unexpected status OK": 20}, res.TestStats["unexpected ok"].Stats.Errorm)
+	require.Equal(t, int64(40), res.Stats.Counters[grpcunit.StatusCounterPrefix+"NotFound"])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users := make(map[string]int)
+	for _, u := range s.md {
+		users[u]++
+	}
+	require.Equal(t, map[string]int{"0": 10, "1": 10}, users)
+}
+
+func TestServerStream(t *testing.T) {
+	s := newServer(t)
+
+	watch := grpcunit.ServerStream(healthpb.Health_Watch_FullMethodName, checkRequest("svc"), checkResponse,
+		grpcunit.ID("watch"),
+		grpcunit.MaxMessages(1),
+		grpcunit.Target("passthrough:///bufnet", grpcunit.PerUserConn, s.dialOptions()...),
+	)
+	defer watch.Close()
+
+	res := run(3, watch)
+	stats := res.TestStats["watch"].Stats
+	require.Equal(t, 30, stats.Passed, stats.Errorm)
+	require.Equal(t, int64(30), stats.Counters[grpcunit.MessagesCounter])
+	require.Equal(t, 30, stats.Phases[grpcunit.FirstMessageTiming].Count)
+	require.Equal(t, 30, stats.Phases[grpcunit.StreamTiming].Count)
+
+	s.lis.mu.Lock()
+	defer s.lis.mu.Unlock()
+	require.Equal(t, 3, s.lis.conns)
+}
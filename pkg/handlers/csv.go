@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+)
+
+// CSVColumn is a column in the CSV output
+type CSVColumn string
+
+// CSV columns
+const (
+	CSVTimestamp CSVColumn = "timestamp"
+	CSVRunner    CSVColumn = "runner"
+	CSVTest      CSVColumn = "test"
+	CSVUser      CSVColumn = "user"
+	CSVIteration CSVColumn = "iteration"
+	CSVOutcome   CSVColumn = "outcome"
+	CSVDuration  CSVColumn = "duration_us"
+	CSVError     CSVColumn = "error"
+)
+
+// DefaultCSVColumns are the default CSV columns
+var DefaultCSVColumns = []CSVColumn{
+	CSVTimestamp,
+	CSVRunner,
+	CSVTest,
+	CSVUser,
+	CSVIteration,
+	CSVOutcome,
+	CSVDuration,
+	CSVError,
+}
+
+// CSVConfig type
+type CSVConfig struct {
+	Columns    []CSVColumn
+	FlushEvery int
+	Header     bool
+}
+
+// CSVOption type
+type CSVOption func(*CSVConfig)
+
+// CSVColumns sets the columns to write (defaults to DefaultCSVColumns)
+func CSVColumns(columns ...CSVColumn) CSVOption {
+	return func(cfg *CSVConfig) {
+		cfg.Columns = columns
+	}
+}
+
+// CSVFlushEvery sets how many rows are buffered before they are
+// flushed to the writer (defaults to 1000). Rows are always flushed
+// when the runner is done.
+func CSVFlushEvery(rows int) CSVOption {
+	return func(cfg *CSVConfig) {
+		cfg.FlushEvery = rows
+	}
+}
+
+// CSVHeader should a header row be written (defaults to true)
+func CSVHeader(b bool) CSVOption {
+	return func(cfg *CSVConfig) {
+		cfg.Header = b
+	}
+}
+
+type csvWriter struct {
+	cfg    *CSVConfig
+	mu     sync.Mutex
+	w      *csv.Writer
+	runner string
+	rows   int
+	record []string
+}
+
+// CSV is a runner handler that writes a row to w for each test result
+// as it is completed. Results are not kept in memory, so it is safe to
+// use on runs of any size.
+func CSV(w io.Writer, options ...CSVOption) spidomtr.RunnerHandler {
+	cfg := &CSVConfig{
+		Columns:    DefaultCSVColumns,
+		FlushEvery: 1000,
+		Header:     true,
+	}
+
+	for _, opt := range options {
+		opt(cfg)
+	}
+
+	return &csvWriter{
+		cfg:    cfg,
+		w:      csv.NewWriter(w),
+		record: make([]string, len(cfg.Columns)),
+	}
+}
+
+// RunnerStarted is called when runner is started (prior to any tests
+// have been run).
+func (c *csvWriter) RunnerStarted(id, description string, count int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.runner = id
+	if !c.cfg.Header {
+		return
+	}
+	for i, col := range c.cfg.Columns {
+		c.record[i] = string(col)
+	}
+	c.write()
+}
+
+// TestDone is called when a test has been completed.
+func (c *csvWriter) TestDone(res spidomtr.TestResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, col := range c.cfg.Columns {
+		c.record[i] = c.value(col, res)
+	}
+	c.write()
+}
+
+// RunnerDone is called when the runner has run all tests.
+func (c *csvWriter) RunnerDone(spidomtr.Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flush()
+}
+
+func (c *csvWriter) value(col CSVColumn, res spidomtr.TestResult) string {
+	switch col {
+	case CSVTimestamp:
+		return res.Date.Format(time.RFC3339Nano)
+	case CSVRunner:
+		return c.runner
+	case CSVTest:
+		return res.ID
+	case CSVUser:
+		return strconv.Itoa(res.User)
+	case CSVIteration:
+		return strconv.Itoa(res.Iteration)
+	case CSVOutcome:
+		return res.Outcome.String()
+	case CSVDuration:
+		return strconv.FormatInt(res.Duration.Microseconds(), 10)
+	case CSVError:
+		if res.Error != nil {
+			return res.Error.Error()
+		}
+	}
+	return ""
+}
+
+func (c *csvWriter) write() {
+	if err := c.w.Write(c.record); err != nil {
+		log.Printf("csv: %v", err)
+		return
+	}
+	c.rows++
+	if c.cfg.FlushEvery > 0 && c.rows%c.cfg.FlushEvery == 0 {
+		c.flush()
+	}
+}
+
+func (c *csvWriter) flush() {
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		log.Printf("csv: %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/handlers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSV(t *testing.T) {
+	t.Run("default columns", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		runStream(handlers.CSV(buf))
+
+		records, err := csv.NewReader(buf).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 41)
+		require.Equal(t, []string{"timestamp", "runner", "test", "user", "iteration", "outcome", "duration_us", "error"}, records[0])
+
+		users := make(map[string]int)
+		for _, r := range records[1:] {
+			require.Equal(t, "stream runner", r[1])
+			users[r[3]]++
+			switch r[2] {
+			case "passing_test":
+				require.Equal(t, "pass", r[5])
+				require.Empty(t, r[7])
+			case "failing_test":
+				require.Equal(t, "fail", r[5])
+				require.Equal(t, `whooops, "bad"`, r[7])
+			}
+		}
+		require.Equal(t, map[string]int{"0": 20, "1": 20}, users)
+	})
+	t.Run("custom columns", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		h := handlers.CSV(buf,
+			handlers.CSVColumns(handlers.CSVTest, handlers.CSVIteration),
+			handlers.CSVHeader(false),
+			handlers.CSVFlushEvery(1),
+		)
+		h.RunnerStarted("id", "", 1)
+		h.TestDone(spidomtr.TestResult{ID: "test", Iteration: 3})
+		require.Equal(t, "test,3\n", buf.String())
+	})
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+)
+
+// DefaultInfluxBatchSize is the default max size in bytes of a batch
+// of Influx lines
+const DefaultInfluxBatchSize = 64 * 1024
+
+var (
+	influxKeyEscaper   = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+	influxFieldEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+// Influx is a runner handler that writes each test result to w in the
+// InfluxDB line protocol. The measurement is tagged with runner ID,
+// test ID and outcome. Counters and custom metrics reported by the test
+// are written to the "<prefix>_metrics" measurement, tagged with metric
+// name and kind, with the value, or the count, sum, min and max of the
+// values of histograms and trends.
+func Influx(w io.Writer, options ...StreamOption) *StreamHandler {
+	cfg := newStreamConfig(DefaultInfluxBatchSize, options)
+	return &StreamHandler{
+		cfg: cfg,
+		encode: func(runner string, res spidomtr.TestResult) []string {
+			return influxLines(cfg.Prefix, runner, res)
+		},
+		send: func(b []byte) error {
+			_, err := w.Write(b)
+			return err
+		},
+	}
+}
+
+// InfluxHTTP is a runner handler that posts each test result in the
+// InfluxDB line protocol to url, e.g. an InfluxDB /write endpoint or
+// a Telegraf http_listener.
+func InfluxHTTP(url string, options ...StreamOption) *StreamHandler {
+	cfg := newStreamConfig(DefaultInfluxBatchSize, options)
+	client := &http.Client{Timeout: 10 * time.Second}
+	return &StreamHandler{
+		cfg: cfg,
+		encode: func(runner string, res spidomtr.TestResult) []string {
+			return influxLines(cfg.Prefix, runner, res)
+		},
+		send: func(b []byte) error {
+			resp, err := client.Post(url, "text/plain; charset=utf-8", bytes.NewReader(b))
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			io.Copy(io.Discard, resp.Body)
+			if resp.StatusCode/100 != 2 {
+				return fmt.Errorf("influx: unexpected status %s", resp.Status)
+			}
+			return nil
+		},
+	}
+}
+
+func influxLines(measurement, runner string, res spidomtr.TestResult) []string {
+	lines := []string{influxLine(measurement, runner, res)}
+
+	tags := ""
+	if runner != "" {
+		tags += ",runner=" + influxKeyEscaper.Replace(runner)
+	}
+	tags += ",test=" + influxKeyEscaper.Replace(res.ID)
+	ts := " " + strconv.FormatInt(res.Date.UnixNano(), 10)
+	metric := func(name, kind, fields string) {
+		lines = append(lines, influxKeyEscaper.Replace(measurement+"_metrics")+tags+
+			",metric="+influxKeyEscaper.Replace(name)+",kind="+kind+" "+fields+ts)
+	}
+
+	for _, name := range sortedNames(res.Counters) {
+		metric(name, spidomtr.CounterKind, "value="+strconv.FormatInt(res.Counters[name], 10)+"i")
+	}
+	for _, name := range sortedNames(res.Gauges) {
+		metric(name, spidomtr.GaugeKind, "value="+influxFloat(res.Gauges[name]))
+	}
+	for _, name := range sortedNames(res.Histograms) {
+		metric(name, spidomtr.HistogramKind, influxSummary(res.Histograms[name]))
+	}
+	for _, name := range sortedNames(res.Trends) {
+		values := make([]float64, len(res.Trends[name]))
+		for i, d := range res.Trends[name] {
+			values[i] = float64(d)
+		}
+		metric(name, spidomtr.TrendKind, influxSummary(values))
+	}
+	return lines
+}
+
+// influxSummary returns the count, sum, min and max fields of values
+func influxSummary(values []float64) string {
+	var sum float64
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		sum += v
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+	if len(values) == 0 {
+		min, max = 0, 0
+	}
+	return "count=" + strconv.Itoa(len(values)) + "i,sum=" + influxFloat(sum) +
+		",min=" + influxFloat(min) + ",max=" + influxFloat(max)
+}
+
+func influxFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func influxLine(measurement, runner string, res spidomtr.TestResult) string {
+	var b strings.Builder
+	b.WriteString(influxKeyEscaper.Replace(measurement))
+	if runner != "" {
+		b.WriteString(",runner=" + influxKeyEscaper.Replace(runner))
+	}
+	b.WriteString(",test=" + influxKeyEscaper.Replace(res.ID))
+	b.WriteString(",outcome=" + res.Outcome.String())
+	b.WriteString(" duration=" + strconv.FormatInt(int64(res.Duration), 10) + "i")
+	b.WriteString(",user=" + strconv.Itoa(res.User) + "i")
+	b.WriteString(",iteration=" + strconv.Itoa(res.Iteration) + "i")
+	if res.Error != nil {
+		b.WriteString(`,error="` + influxFieldEscaper.Replace(res.Error.Error()) + `"`)
+	}
+	b.WriteString(" " + strconv.FormatInt(res.Date.UnixNano(), 10))
+	return b.String()
+}
@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+)
+
+// Predicate reports whether a test result should be passed on to a
+// handler
+type Predicate func(spidomtr.TestResult) bool
+
+// Outcomes matches test results with any of the given outcomes
+func Outcomes(outcomes ...testunit.TestOutcome) Predicate {
+	return func(res spidomtr.TestResult) bool {
+		for _, o := range outcomes {
+			if res.Outcome == o {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// TestIDs matches test results from any of the given tests
+func TestIDs(ids ...string) Predicate {
+	return func(res spidomtr.TestResult) bool {
+		for _, id := range ids {
+			if res.ID == id {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// wrapper forwards all runner events to the wrapped handler, including
+// the ones of the optional handler interfaces.
+type wrapper struct {
+	h spidomtr.RunnerHandler
+}
+
+func (w wrapper) RunnerConfig(cfg spidomtr.Config) {
+	if ch, ok := w.h.(spidomtr.ConfigHandler); ok {
+		ch.RunnerConfig(cfg)
+	}
+}
+
+func (w wrapper) RunnerStarted(id, description string, count int) {
+	w.h.RunnerStarted(id, description, count)
+}
+
+func (w wrapper) UserStarted(user int) {
+	if uh, ok := w.h.(spidomtr.UserHandler); ok {
+		uh.UserStarted(user)
+	}
+}
+
+func (w wrapper) TestStarted(id string, user, iteration int) {
+	if sh, ok := w.h.(spidomtr.TestStartedHandler); ok {
+		sh.TestStarted(id, user, iteration)
+	}
+}
+
+func (w wrapper) TestDone(res spidomtr.TestResult) {
+	w.h.TestDone(res)
+}
+
+func (w wrapper) UserDone(user int) {
+	if uh, ok := w.h.(spidomtr.UserHandler); ok {
+		uh.UserDone(user)
+	}
+}
+
+func (w wrapper) RunnerDone(res spidomtr.Result) {
+	w.h.RunnerDone(res)
+}
+
+type filter struct {
+	wrapper
+	pred Predicate
+}
+
+// Filter passes on only the test results matching pred to h. All other
+// events are always passed on.
+func Filter(pred Predicate, h spidomtr.RunnerHandler) spidomtr.RunnerHandler {
+	return &filter{wrapper: wrapper{h: h}, pred: pred}
+}
+
+// TestDone is called when a test has been completed.
+func (f *filter) TestDone(res spidomtr.TestResult) {
+	if f.pred(res) {
+		f.h.TestDone(res)
+	}
+}
+
+type sample struct {
+	wrapper
+	rate float64
+	n    int64
+}
+
+// Sample passes on a fraction rate (0-1) of the test results to h,
+// evenly spread over the run. All other events are always passed on.
+func Sample(rate float64, h spidomtr.RunnerHandler) spidomtr.RunnerHandler {
+	return &sample{wrapper: wrapper{h: h}, rate: rate}
+}
+
+// TestDone is called when a test has been completed.
+func (s *sample) TestDone(res spidomtr.TestResult) {
+	n := atomic.AddInt64(&s.n, 1)
+	if int64(float64(n)*s.rate) > int64(float64(n-1)*s.rate) {
+		s.h.TestDone(res)
+	}
+}
+
+type throttle struct {
+	wrapper
+	per  time.Duration
+	mu   sync.Mutex
+	last time.Time
+}
+
+// Throttle passes on at most one test result per interval per to h,
+// dropping the rest. All other events are always passed on.
+func Throttle(per time.Duration, h spidomtr.RunnerHandler) spidomtr.RunnerHandler {
+	return &throttle{wrapper: wrapper{h: h}, per: per}
+}
+
+// TestDone is called when a test has been completed.
+func (t *throttle) TestDone(res spidomtr.TestResult) {
+	t.mu.Lock()
+	now := time.Now()
+	if !t.last.IsZero() && now.Sub(t.last) < t.per {
+		t.mu.Unlock()
+		return
+	}
+	t.last = now
+	t.mu.Unlock()
+
+	t.h.TestDone(res)
+}
+
+type async struct {
+	wrapper
+	buffer int
+	mu     sync.Mutex
+	closed bool
+	events chan func()
+	done   chan struct{}
+}
+
+// Async passes on all events to h from a separate goroutine, so a slow
+// handler does not slow down the tests. Events are queued in a buffer
+// of the given size, and sending blocks if the buffer is full.
+// RunnerDone returns once h has handled all queued events, and events
+// after RunnerDone are dropped.
+func Async(h spidomtr.RunnerHandler, buffer int) spidomtr.RunnerHandler {
+	return &async{wrapper: wrapper{h: h}, buffer: buffer}
+}
+
+// RunnerStarted is called when runner is started (prior to any tests
+// have been run).
+func (a *async) RunnerStarted(id, description string, count int) {
+	a.mu.Lock()
+	a.closed = false
+	a.events = make(chan func(), a.buffer)
+	a.done = make(chan struct{})
+	a.mu.Unlock()
+
+	go func(events chan func(), done chan struct{}) {
+		defer close(done)
+		for event := range events {
+			event()
+		}
+	}(a.events, a.done)
+	a.send(func() { a.wrapper.RunnerStarted(id, description, count) })
+}
+
+// UserStarted is called when a user starts running tests.
+func (a *async) UserStarted(user int) {
+	a.send(func() { a.wrapper.UserStarted(user) })
+}
+
+// TestStarted is called right before a test is run.
+func (a *async) TestStarted(id string, user, iteration int) {
+	a.send(func() { a.wrapper.TestStarted(id, user, iteration) })
+}
+
+// TestDone is called when a test has been completed.
+func (a *async) TestDone(res spidomtr.TestResult) {
+	a.send(func() { a.wrapper.TestDone(res) })
+}
+
+// UserDone is called when a user has run all its tests.
+func (a *async) UserDone(user int) {
+	a.send(func() { a.wrapper.UserDone(user) })
+}
+
+// RunnerDone is called when the runner has run all tests.
+func (a *async) RunnerDone(res spidomtr.Result) {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return
+	}
+	a.events <- func() { a.wrapper.RunnerDone(res) }
+	a.closed = true
+	close(a.events)
+	done := a.done
+	a.mu.Unlock()
+
+	<-done
+}
+
+// send queues event, unless the runner is done
+func (a *async) send(event func()) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return
+	}
+	a.events <- event
+}
+
+type multi []spidomtr.RunnerHandler
+
+// Multi passes on all events to each of the handlers, in order.
+func Multi(hs ...spidomtr.RunnerHandler) spidomtr.RunnerHandler {
+	return multi(hs)
+}
+
+// RunnerConfig is called with the runner config before RunnerStarted.
+func (m multi) RunnerConfig(cfg spidomtr.Config) {
+	for _, h := range m {
+		wrapper{h: h}.RunnerConfig(cfg)
+	}
+}
+
+// RunnerStarted is called when runner is started (prior to any tests
+// have been run).
+func (m multi) RunnerStarted(id, description string, count int) {
+	for _, h := range m {
+		h.RunnerStarted(id, description, count)
+	}
+}
+
+// UserStarted is called when a user starts running tests.
+func (m multi) UserStarted(user int) {
+	for _, h := range m {
+		wrapper{h: h}.UserStarted(user)
+	}
+}
+
+// TestStarted is called right before a test is run.
+func (m multi) TestStarted(id string, user, iteration int) {
+	for _, h := range m {
+		wrapper{h: h}.TestStarted(id, user, iteration)
+	}
+}
+
+// TestDone is called when a test has been completed.
+func (m multi) TestDone(res spidomtr.TestResult) {
+	for _, h := range m {
+		h.TestDone(res)
+	}
+}
+
+// UserDone is called when a user has run all its tests.
+func (m multi) UserDone(user int) {
+	for _, h := range m {
+		wrapper{h: h}.UserDone(user)
+	}
+}
+
+// RunnerDone is called when the runner has run all tests.
+func (m multi) RunnerDone(res spidomtr.Result) {
+	for _, h := range m {
+		h.RunnerDone(res)
+	}
+}
@@ -0,0 +1,113 @@
+package handlers_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/handlers"
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	mu      sync.Mutex
+	started int
+	users   int
+	tests   int
+	results []spidomtr.TestResult
+	done    int
+}
+
+func (r *recorder) RunnerStarted(string, string, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.started++
+}
+
+func (r *recorder) UserStarted(int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users++
+}
+
+func (r *recorder) UserDone(int) {}
+
+func (r *recorder) TestStarted(string, int, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tests++
+}
+
+func (r *recorder) TestDone(res spidomtr.TestResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	time.Sleep(time.Millisecond)
+	r.results = append(r.results, res)
+}
+
+func (r *recorder) RunnerDone(spidomtr.Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done++
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Run("filter", func(t *testing.T) {
+		rec := &recorder{}
+		runStream(handlers.Filter(handlers.Outcomes(testunit.Fail), rec))
+		require.Equal(t, 1, rec.started)
+		require.Equal(t, 2, rec.users)
+		require.Equal(t, 40, rec.tests)
+		require.Len(t, rec.results, 20)
+		for _, res := range rec.results {
+			require.Equal(t, "failing_test", res.ID)
+		}
+		require.Equal(t, 1, rec.done)
+
+		rec = &recorder{}
+		runStream(handlers.Filter(handlers.TestIDs("passing_test"), rec))
+		require.Len(t, rec.results, 20)
+	})
+	t.Run("sample", func(t *testing.T) {
+		rec := &recorder{}
+		runStream(handlers.Sample(0.25, rec))
+		require.Len(t, rec.results, 10)
+	})
+	t.Run("throttle", func(t *testing.T) {
+		rec := &recorder{}
+		runStream(handlers.Throttle(time.Hour, rec))
+		require.Len(t, rec.results, 1)
+	})
+	t.Run("async", func(t *testing.T) {
+		rec := &recorder{}
+		h := handlers.Async(rec, 1)
+		runStream(h)
+		require.Equal(t, 1, rec.started)
+		require.Equal(t, 2, rec.users)
+		require.Equal(t, 40, rec.tests)
+		require.Len(t, rec.results, 40)
+		require.Equal(t, 1, rec.done)
+
+		// Events after RunnerDone are dropped
+		require.NotPanics(t, func() {
+			h.TestDone(spidomtr.TestResult{ID: "late"})
+			h.(spidomtr.UserHandler).UserDone(0)
+			h.(spidomtr.TestStartedHandler).TestStarted("late", 0, 0)
+			h.RunnerDone(spidomtr.Result{})
+		})
+		require.Len(t, rec.results, 40)
+		require.Equal(t, 1, rec.done)
+	})
+	t.Run("multi", func(t *testing.T) {
+		rec1, rec2 := &recorder{}, &recorder{}
+		runStream(handlers.Multi(
+			handlers.Filter(handlers.Outcomes(testunit.Fail), rec1),
+			rec2,
+		))
+		require.Len(t, rec1.results, 20)
+		require.Len(t, rec2.results, 40)
+		require.Equal(t, 40, rec2.tests)
+	})
+}
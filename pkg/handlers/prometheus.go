@@ -0,0 +1,383 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+)
+
+// DefaultPrometheusBuckets are the default latency histogram buckets
+var DefaultPrometheusBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// PrometheusOption type
+type PrometheusOption func(*PrometheusExporter)
+
+// PrometheusBuckets sets the upper bounds of the latency histogram
+// buckets (defaults to DefaultPrometheusBuckets)
+func PrometheusBuckets(buckets ...time.Duration) PrometheusOption {
+	return func(e *PrometheusExporter) {
+		e.buckets = append([]time.Duration(nil), buckets...)
+		sort.Slice(e.buckets, func(i, j int) bool {
+			return e.buckets[i] < e.buckets[j]
+		})
+	}
+}
+
+type outcomeKey struct {
+	test    string
+	outcome string
+}
+
+type metricKey struct {
+	test string
+	name string
+}
+
+type metricSummary struct {
+	count int
+	sum   float64
+}
+
+type latencyHistogram struct {
+	counts []int
+	count  int
+	sum    time.Duration
+}
+
+// PrometheusExporter is a runner handler that serves test metrics in
+// the Prometheus text exposition format.
+type PrometheusExporter struct {
+	addr    string
+	buckets []time.Duration
+
+	listener net.Listener
+	server   *http.Server
+
+	mu          sync.Mutex
+	runner      string
+	description string
+	planned     int
+	outcomes    map[outcomeKey]int
+	latencies   map[string]*latencyHistogram
+	counters    map[metricKey]int64
+	gauges      map[metricKey]float64
+	histograms  map[metricKey]*metricSummary
+	trends      map[metricKey]*metricSummary
+	activeUsers int
+	inFlight    int
+}
+
+// Prometheus is a runner handler that serves a /metrics endpoint on
+// addr while the runner is running. The endpoint stays up after the
+// run has completed until Close is called, so the final values can be
+// scraped.
+func Prometheus(addr string, options ...PrometheusOption) *PrometheusExporter {
+	e := &PrometheusExporter{
+		addr:       addr,
+		buckets:    DefaultPrometheusBuckets,
+		outcomes:   make(map[outcomeKey]int),
+		latencies:  make(map[string]*latencyHistogram),
+		counters:   make(map[metricKey]int64),
+		gauges:     make(map[metricKey]float64),
+		histograms: make(map[metricKey]*metricSummary),
+		trends:     make(map[metricKey]*metricSummary),
+	}
+
+	for _, opt := range options {
+		opt(e)
+	}
+
+	return e
+}
+
+// Addr returns the address the metrics endpoint listens on, or an
+// empty string if it has not been started.
+func (e *PrometheusExporter) Addr() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.listener == nil {
+		return ""
+	}
+	return e.listener.Addr().String()
+}
+
+// Close shuts down the metrics endpoint.
+func (e *PrometheusExporter) Close() error {
+	e.mu.Lock()
+	server := e.server
+	e.server = nil
+	e.listener = nil
+	e.mu.Unlock()
+
+	if server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return server.Shutdown(ctx)
+}
+
+// RunnerStarted is called when runner is started (prior to any tests
+// have been run).
+func (e *PrometheusExporter) RunnerStarted(id, description string, count int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.runner = id
+	e.description = description
+	e.planned = count
+
+	if e.server != nil {
+		return
+	}
+
+	l, err := net.Listen("tcp", e.addr)
+	if err != nil {
+		log.Printf("prometheus: %v", err)
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+	e.listener = l
+	e.server = &http.Server{Handler: mux}
+	go func(server *http.Server) {
+		if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.Printf("prometheus: %v", err)
+		}
+	}(e.server)
+}
+
+// UserStarted is called when a user starts running tests.
+func (e *PrometheusExporter) UserStarted(int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.activeUsers++
+}
+
+// UserDone is called when a user has run all its tests.
+func (e *PrometheusExporter) UserDone(int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.activeUsers--
+}
+
+// TestStarted is called right before a test is run.
+func (e *PrometheusExporter) TestStarted(string, int, int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.inFlight++
+}
+
+// TestDone is called when a test has been completed.
+func (e *PrometheusExporter) TestDone(res spidomtr.TestResult) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.outcomes[outcomeKey{test: res.ID, outcome: res.Outcome.String()}]++
+
+	for name, n := range res.Counters {
+		e.counters[metricKey{test: res.ID, name: name}] += n
+	}
+	for name, v := range res.Gauges {
+		e.gauges[metricKey{test: res.ID, name: name}] = v
+	}
+	for name, values := range res.Histograms {
+		m := summary(e.histograms, metricKey{test: res.ID, name: name})
+		for _, v := range values {
+			m.count++
+			m.sum += v
+		}
+	}
+	for name, durations := range res.Trends {
+		m := summary(e.trends, metricKey{test: res.ID, name: name})
+		for _, d := range durations {
+			m.count++
+			m.sum += d.Seconds()
+		}
+	}
+
+	// Skipped tests are never started
+	if res.Outcome == testunit.Skip {
+		return
+	}
+	e.inFlight--
+
+	h, ok := e.latencies[res.ID]
+	if !ok {
+		h = &latencyHistogram{counts: make([]int, len(e.buckets))}
+		e.latencies[res.ID] = h
+	}
+	if res.Outcome != testunit.Pass {
+		return
+	}
+	h.count++
+	h.sum += res.Duration
+	for i, b := range e.buckets {
+		if res.Duration <= b {
+			h.counts[i]++
+		}
+	}
+}
+
+// RunnerDone is called when the runner has run all tests.
+func (e *PrometheusExporter) RunnerDone(spidomtr.Result) {}
+
+// ServeHTTP writes the current metrics in the Prometheus text
+// exposition format.
+func (e *PrometheusExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	e.write(bw)
+	bw.Flush()
+}
+
+func (e *PrometheusExporter) write(w io.Writer) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	runner := label("runner", e.runner)
+
+	fmt.Fprint(w, "# HELP spidomtr_runner_info Runner metadata.\n")
+	fmt.Fprint(w, "# TYPE spidomtr_runner_info gauge\n")
+	fmt.Fprintf(w, "spidomtr_runner_info{%s,%s} 1\n", runner, label("description", e.description))
+
+	fmt.Fprint(w, "# HELP spidomtr_runner_tests Number of tests the runner will run.\n")
+	fmt.Fprint(w, "# TYPE spidomtr_runner_tests gauge\n")
+	fmt.Fprintf(w, "spidomtr_runner_tests{%s} %d\n", runner, e.planned)
+
+	fmt.Fprint(w, "# HELP spidomtr_active_users Number of users currently running tests.\n")
+	fmt.Fprint(w, "# TYPE spidomtr_active_users gauge\n")
+	fmt.Fprintf(w, "spidomtr_active_users{%s} %d\n", runner, e.activeUsers)
+
+	fmt.Fprint(w, "# HELP spidomtr_tests_in_flight Number of tests currently running.\n")
+	fmt.Fprint(w, "# TYPE spidomtr_tests_in_flight gauge\n")
+	fmt.Fprintf(w, "spidomtr_tests_in_flight{%s} %d\n", runner, e.inFlight)
+
+	keys := make([]outcomeKey, 0, len(e.outcomes))
+	for k := range e.outcomes {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].test != keys[j].test {
+			return keys[i].test < keys[j].test
+		}
+		return keys[i].outcome < keys[j].outcome
+	})
+
+	fmt.Fprint(w, "# HELP spidomtr_tests_total Number of completed tests by outcome.\n")
+	fmt.Fprint(w, "# TYPE spidomtr_tests_total counter\n")
+	for _, k := range keys {
+		fmt.Fprintf(w, "spidomtr_tests_total{%s,%s,%s} %d\n", runner, label("test", k.test), label("outcome", k.outcome), e.outcomes[k])
+	}
+
+	ids := make([]string, 0, len(e.latencies))
+	for id := range e.latencies {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	fmt.Fprint(w, "# HELP spidomtr_test_duration_seconds Latency of passed tests.\n")
+	fmt.Fprint(w, "# TYPE spidomtr_test_duration_seconds histogram\n")
+	for _, id := range ids {
+		h := e.latencies[id]
+		test := label("test", id)
+		for i, b := range e.buckets {
+			le := label("le", strconv.FormatFloat(b.Seconds(), 'g', -1, 64))
+			fmt.Fprintf(w, "spidomtr_test_duration_seconds_bucket{%s,%s,%s} %d\n", runner, test, le, h.counts[i])
+		}
+		fmt.Fprintf(w, "spidomtr_test_duration_seconds_bucket{%s,%s,%s} %d\n", runner, test, label("le", "+Inf"), h.count)
+		fmt.Fprintf(w, "spidomtr_test_duration_seconds_sum{%s,%s} %s\n", runner, test, strconv.FormatFloat(h.sum.Seconds(), 'g', -1, 64))
+		fmt.Fprintf(w, "spidomtr_test_duration_seconds_count{%s,%s} %d\n", runner, test, h.count)
+	}
+
+	if len(e.counters) > 0 {
+		fmt.Fprint(w, "# HELP spidomtr_metric_total Custom counters reported by tests.\n")
+		fmt.Fprint(w, "# TYPE spidomtr_metric_total counter\n")
+		for _, k := range sortedMetricKeys(e.counters) {
+			fmt.Fprintf(w, "spidomtr_metric_total{%s,%s,%s} %d\n", runner, label("test", k.test), label("name", k.name), e.counters[k])
+		}
+	}
+
+	if len(e.gauges) > 0 {
+		fmt.Fprint(w, "# HELP spidomtr_metric_gauge Last value of custom gauges reported by tests.\n")
+		fmt.Fprint(w, "# TYPE spidomtr_metric_gauge gauge\n")
+		for _, k := range sortedMetricKeys(e.gauges) {
+			fmt.Fprintf(w, "spidomtr_metric_gauge{%s,%s,%s} %s\n", runner, label("test", k.test), label("name", k.name), strconv.FormatFloat(e.gauges[k], 'g', -1, 64))
+		}
+	}
+
+	if len(e.histograms) > 0 {
+		fmt.Fprint(w, "# HELP spidomtr_metric_values Custom histograms reported by tests.\n")
+		fmt.Fprint(w, "# TYPE spidomtr_metric_values summary\n")
+		writeSummaries(w, "spidomtr_metric_values", runner, e.histograms)
+	}
+
+	if len(e.trends) > 0 {
+		fmt.Fprint(w, "# HELP spidomtr_metric_seconds Custom trends reported by tests.\n")
+		fmt.Fprint(w, "# TYPE spidomtr_metric_seconds summary\n")
+		writeSummaries(w, "spidomtr_metric_seconds", runner, e.trends)
+	}
+}
+
+func writeSummaries(w io.Writer, name, runner string, summaries map[metricKey]*metricSummary) {
+	for _, k := range sortedMetricKeys(summaries) {
+		m := summaries[k]
+		labels := runner + "," + label("test", k.test) + "," + label("name", k.name)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, strconv.FormatFloat(m.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, m.count)
+	}
+}
+
+func summary(summaries map[metricKey]*metricSummary, k metricKey) *metricSummary {
+	m, ok := summaries[k]
+	if !ok {
+		m = &metricSummary{}
+		summaries[k] = m
+	}
+	return m
+}
+
+func sortedMetricKeys[V any](m map[metricKey]V) []metricKey {
+	keys := make([]metricKey, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].test != keys[j].test {
+			return keys[i].test < keys[j].test
+		}
+		return keys[i].name < keys[j].name
+	})
+	return keys
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func label(name, value string) string {
+	return name + `="` + labelEscaper.Replace(value) + `"`
+}
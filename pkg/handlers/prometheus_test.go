@@ -0,0 +1,84 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/handlers"
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheus(t *testing.T) {
+	exporter := handlers.Prometheus("127.0.0.1:0",
+		handlers.PrometheusBuckets(time.Second, 10*time.Millisecond),
+	)
+	defer exporter.Close()
+
+	runner := spidomtr.NewRunner(
+		spidomtr.ID("prom"),
+		spidomtr.Description("prometheus tests"),
+		spidomtr.Handlers(exporter),
+		spidomtr.Iterations(10),
+		spidomtr.ShowLogo(false),
+		spidomtr.ShowSummary(false),
+		spidomtr.Users(2),
+	)
+
+	test1 := testunit.New(
+		testunit.ID("passing_test"),
+		testunit.Test(func(ctx context.Context, _ []interface{}) ([]interface{}, error) {
+			metrics := spidomtr.MetricsFromContext(ctx)
+			metrics.Counter("bytes").Add(3)
+			metrics.Gauge("depth").Set(2.5)
+			metrics.Histogram("items").Observe(4)
+			metrics.Trend("wait").Add(500 * time.Millisecond)
+			return nil, nil
+		}),
+	)
+	test2 := testunit.New(
+		testunit.ID("failing_test"),
+		testunit.Test(func(context.Context, []interface{}) ([]interface{}, error) {
+			return nil, errors.New("whooops")
+		}),
+	)
+	test3 := testunit.New(
+		testunit.ID("skipped_test"),
+		testunit.Enabled(func() (bool, string) {
+			return false, "leave me alone"
+		}),
+	)
+
+	runner.Run(context.Background(), test1, test2, test3)
+
+	resp, err := http.Get("http://" + exporter.Addr() + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	body := string(b)
+
+	require.Contains(t, body, `spidomtr_runner_info{runner="prom",description="prometheus tests"} 1`)
+	require.Contains(t, body, `spidomtr_runner_tests{runner="prom"} 60`)
+	require.Contains(t, body, `spidomtr_active_users{runner="prom"} 0`)
+	require.Contains(t, body, `spidomtr_tests_in_flight{runner="prom"} 0`)
+	require.Contains(t, body, `spidomtr_tests_total{runner="prom",test="passing_test",outcome="pass"} 20`)
+	require.Contains(t, body, `spidomtr_tests_total{runner="prom",test="failing_test",outcome="fail"} 20`)
+	require.Contains(t, body, `spidomtr_tests_total{runner="prom",test="skipped_test",outcome="skip"} 20`)
+	require.Contains(t, body, `spidomtr_test_duration_seconds_bucket{runner="prom",test="passing_test",le="0.01"} 20`)
+	require.Contains(t, body, `spidomtr_test_duration_seconds_bucket{runner="prom",test="passing_test",le="+Inf"} 20`)
+	require.Contains(t, body, `spidomtr_test_duration_seconds_count{runner="prom",test="failing_test"} 0`)
+	require.Contains(t, body, `spidomtr_metric_total{runner="prom",test="passing_test",name="bytes"} 60`)
+	require.Contains(t, body, `spidomtr_metric_gauge{runner="prom",test="passing_test",name="depth"} 2.5`)
+	require.Contains(t, body, `spidomtr_metric_values_sum{runner="prom",test="passing_test",name="items"} 80`)
+	require.Contains(t, body, `spidomtr_metric_values_count{runner="prom",test="passing_test",name="items"} 20`)
+	require.Contains(t, body, `spidomtr_metric_seconds_sum{runner="prom",test="passing_test",name="wait"} 10`)
+	require.Contains(t, body, `spidomtr_metric_seconds_count{runner="prom",test="passing_test",name="wait"} 20`)
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+	"github.com/thepatrik/strcolor"
+)
+
+// SlogConfig type
+type SlogConfig struct {
+	SamplePasses int
+}
+
+// SlogOption type
+type SlogOption func(*SlogConfig)
+
+// SamplePasses logs only one in every n passed tests (defaults to 1,
+// i.e. every passed test is logged). Failed and skipped tests are
+// always logged.
+func SamplePasses(n int) SlogOption {
+	return func(cfg *SlogConfig) {
+		cfg.SamplePasses = n
+	}
+}
+
+type slogLogger struct {
+	cfg    *SlogConfig
+	log    *slog.Logger
+	runner string
+	passes int64
+}
+
+// Slog is a runner handler that emits a structured log record for each
+// test. Failed tests are logged at error level, skipped tests at info
+// level and passed tests at debug level. If logger is nil, records are
+// written to stdout at debug level, in color only if stdout is a
+// terminal.
+func Slog(logger *slog.Logger, options ...SlogOption) spidomtr.RunnerHandler {
+	cfg := &SlogConfig{
+		SamplePasses: 1,
+	}
+
+	for _, opt := range options {
+		opt(cfg)
+	}
+
+	if logger == nil {
+		opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+		if isTerminal(os.Stdout) {
+			logger = slog.New(&colorHandler{w: os.Stdout, mu: &sync.Mutex{}, level: opts.Level})
+		} else {
+			logger = slog.New(slog.NewTextHandler(os.Stdout, opts))
+		}
+	}
+
+	return &slogLogger{cfg: cfg, log: logger}
+}
+
+// RunnerStarted is called when runner is started (prior to any tests
+// have been run).
+func (l *slogLogger) RunnerStarted(id, description string, count int) {
+	l.runner = id
+	l.log.LogAttrs(context.Background(), slog.LevelInfo, "runner started",
+		slog.String("runner", id),
+		slog.String("description", description),
+		slog.Int("tests", count),
+	)
+}
+
+// TestDone is called when a test has been completed.
+func (l *slogLogger) TestDone(res spidomtr.TestResult) {
+	var level slog.Level
+	switch res.Outcome {
+	case testunit.Fail:
+		level = slog.LevelError
+	case testunit.Skip:
+		level = slog.LevelInfo
+	case testunit.Pass:
+		level = slog.LevelDebug
+		n := atomic.AddInt64(&l.passes, 1)
+		if l.cfg.SamplePasses > 1 && (n-1)%int64(l.cfg.SamplePasses) != 0 {
+			return
+		}
+	}
+
+	ctx := context.Background()
+	if !l.log.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("runner", l.runner),
+		slog.String("test", res.ID),
+		slog.String("outcome", res.Outcome.String()),
+		slog.Duration("duration", res.Duration),
+		slog.Int("user", res.User),
+		slog.Int("iteration", res.Iteration),
+	}
+	switch {
+	case res.Error != nil:
+		attrs = append(attrs, slog.String("error", res.Error.Error()))
+	case res.Comment != "":
+		attrs = append(attrs, slog.String("comment", res.Comment))
+	}
+	if res.Record != nil {
+		attrs = append(attrs, slog.Any("record", res.Record))
+	}
+	l.log.LogAttrs(ctx, level, "test done", attrs...)
+}
+
+// RunnerDone is called when the runner has run all tests.
+func (l *slogLogger) RunnerDone(res spidomtr.Result) {
+	level := slog.LevelInfo
+	if res.Stats.Errors > 0 {
+		level = slog.LevelError
+	}
+	l.log.LogAttrs(context.Background(), level, "runner done",
+		slog.String("runner", l.runner),
+		slog.Int("count", res.Stats.Count),
+		slog.Int("passed", res.Stats.Passed),
+		slog.Int("failed", res.Stats.Errors),
+		slog.Int("skipped", res.Stats.Skips),
+		slog.Duration("duration", res.Stats.Duration),
+		slog.Duration("average", res.Stats.Average),
+	)
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// colorHandler is a minimal slog.Handler writing human readable lines
+// with colored levels to a terminal.
+type colorHandler struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	level  slog.Leveler
+	attrs  []slog.Attr
+	prefix string
+}
+
+func (h *colorHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *colorHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+
+	level := r.Level.String()
+	switch {
+	case r.Level >= slog.LevelError:
+		level = strcolor.Red(level).String()
+	case r.Level >= slog.LevelWarn:
+		level = strcolor.Yellow(level).String()
+	case r.Level >= slog.LevelInfo:
+		level = strcolor.Green(level).String()
+	}
+	fmt.Fprintf(&b, "%s %s", level, r.Message)
+
+	for _, a := range h.attrs {
+		fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		fmt.Fprintf(&b, " %s%s=%v", h.prefix, a.Key, a.Value)
+		return true
+	})
+	b.WriteString("\n")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *colorHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		a.Key = h.prefix + a.Key
+		c.attrs = append(c.attrs, a)
+	}
+	return &c
+}
+
+func (h *colorHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.prefix = h.prefix + name + "."
+	return &c
+}
@@ -0,0 +1,41 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/spider-pigs/spidomtr/pkg/handlers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	runStream(handlers.Slog(logger, handlers.SamplePasses(5)))
+
+	levels := make(map[string]int)
+	var failed map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		rec := make(map[string]interface{})
+		require.NoError(t, json.Unmarshal([]byte(line), &rec))
+		if rec["msg"] != "test done" {
+			continue
+		}
+		levels[rec["level"].(string)]++
+		if rec["outcome"] == "fail" {
+			failed = rec
+		}
+	}
+
+	// 20 passes sampled 1 in 5, 20 failures
+	require.Equal(t, map[string]int{"DEBUG": 4, "ERROR": 20}, levels)
+	require.Equal(t, "stream runner", failed["runner"])
+	require.Equal(t, "failing_test", failed["test"])
+	require.Equal(t, `whooops, "bad"`, failed["error"])
+	require.Contains(t, failed, "user")
+	require.Contains(t, failed, "iteration")
+}
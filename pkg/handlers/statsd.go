@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+)
+
+// DefaultStatsDBatchSize is the default max size in bytes of a StatsD
+// packet, chosen to fit in a single ethernet frame
+const DefaultStatsDBatchSize = 1432
+
+var statsdTagEscaper = strings.NewReplacer(",", "_", "|", "_", ":", "_", "#", "_")
+
+// StatsD is a runner handler that sends a counter for each test result
+// and a timer for each passed test to the StatsD server at addr over
+// UDP. Counters and custom metrics reported by the test are sent as
+// "<prefix>.metrics.<name>" counters, gauges, histograms and timers.
+// Metrics are tagged with runner ID, test ID and outcome using the
+// DogStatsD tag format, which is also understood by Telegraf.
+func StatsD(addr string, options ...StreamOption) *StreamHandler {
+	cfg := newStreamConfig(DefaultStatsDBatchSize, options)
+
+	var conn net.Conn
+	s := &StreamHandler{
+		cfg: cfg,
+		encode: func(runner string, res spidomtr.TestResult) []string {
+			return statsdLines(cfg.Prefix, runner, res)
+		},
+		send: func(b []byte) error {
+			if conn == nil {
+				c, err := net.Dial("udp", addr)
+				if err != nil {
+					return err
+				}
+				conn = c
+			}
+			_, err := conn.Write(b)
+			return err
+		},
+	}
+	s.closer = func() error {
+		if conn == nil {
+			return nil
+		}
+		err := conn.Close()
+		conn = nil
+		return err
+	}
+	return s
+}
+
+func statsdLines(prefix, runner string, res spidomtr.TestResult) []string {
+	tags := "|#"
+	if runner != "" {
+		tags += "runner:" + statsdTagEscaper.Replace(runner) + ","
+	}
+	tags += "test:" + statsdTagEscaper.Replace(res.ID) + ",outcome:" + res.Outcome.String()
+
+	lines := []string{prefix + ".tests:1|c" + tags}
+	if res.Outcome == testunit.Pass {
+		ms := strconv.FormatFloat(float64(res.Duration)/1e6, 'f', -1, 64)
+		lines = append(lines, prefix+".duration:"+ms+"|ms"+tags)
+	}
+
+	metric := func(name, value, typ string) {
+		lines = append(lines, prefix+".metrics."+statsdTagEscaper.Replace(name)+":"+value+"|"+typ+tags)
+	}
+	for _, name := range sortedNames(res.Counters) {
+		metric(name, strconv.FormatInt(res.Counters[name], 10), "c")
+	}
+	for _, name := range sortedNames(res.Gauges) {
+		metric(name, strconv.FormatFloat(res.Gauges[name], 'f', -1, 64), "g")
+	}
+	for _, name := range sortedNames(res.Histograms) {
+		for _, v := range res.Histograms[name] {
+			metric(name, strconv.FormatFloat(v, 'f', -1, 64), "h")
+		}
+	}
+	for _, name := range sortedNames(res.Trends) {
+		for _, d := range res.Trends[name] {
+			metric(name, strconv.FormatFloat(float64(d)/1e6, 'f', -1, 64), "ms")
+		}
+	}
+	return lines
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+)
+
+// DefaultStreamBufferSize is the default number of metric lines that
+// can be queued before new lines are dropped
+const DefaultStreamBufferSize = 10000
+
+// DefaultStreamFlushInterval is the default max time a metric line is
+// held in a batch before it is sent
+const DefaultStreamFlushInterval = time.Second
+
+// StreamConfig type
+type StreamConfig struct {
+	BatchSize     int
+	BufferSize    int
+	FlushInterval time.Duration
+	Prefix        string
+}
+
+// StreamOption type
+type StreamOption func(*StreamConfig)
+
+// BatchSize sets the max size in bytes of a batch of metric lines
+func BatchSize(bytes int) StreamOption {
+	return func(cfg *StreamConfig) {
+		cfg.BatchSize = bytes
+	}
+}
+
+// BufferSize sets the number of metric lines that can be queued
+// before new lines are dropped (defaults to 10000)
+func BufferSize(lines int) StreamOption {
+	return func(cfg *StreamConfig) {
+		cfg.BufferSize = lines
+	}
+}
+
+// FlushInterval sets how often batches are sent even if they are not
+// full (defaults to 1 sec)
+func FlushInterval(d time.Duration) StreamOption {
+	return func(cfg *StreamConfig) {
+		cfg.FlushInterval = d
+	}
+}
+
+// Prefix sets the measurement (Influx) or metric name (StatsD) prefix
+// (defaults to "spidomtr")
+func Prefix(prefix string) StreamOption {
+	return func(cfg *StreamConfig) {
+		cfg.Prefix = prefix
+	}
+}
+
+// StreamHandler is a runner handler that encodes each test result to
+// one or more metric lines and sends them in batches from a background
+// goroutine. Lines are dropped rather than blocking the tests when the
+// buffer is full, or when the runner is done.
+type StreamHandler struct {
+	cfg     *StreamConfig
+	encode  func(runner string, res spidomtr.TestResult) []string
+	send    func([]byte) error
+	closer  func() error
+	runner  string
+	mu      sync.Mutex
+	closed  bool
+	lines   chan string
+	done    chan struct{}
+	dropped int64
+	once    sync.Once
+}
+
+func newStreamConfig(batchSize int, options []StreamOption) *StreamConfig {
+	cfg := &StreamConfig{
+		BatchSize:     batchSize,
+		BufferSize:    DefaultStreamBufferSize,
+		FlushInterval: DefaultStreamFlushInterval,
+		Prefix:        "spidomtr",
+	}
+
+	for _, opt := range options {
+		opt(cfg)
+	}
+
+	return cfg
+}
+
+// Dropped returns the number of metric lines that have been dropped
+// because the buffer was full.
+func (s *StreamHandler) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// RunnerStarted is called when runner is started (prior to any tests
+// have been run).
+func (s *StreamHandler) RunnerStarted(id, description string, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runner = id
+	s.closed = false
+	s.lines = make(chan string, s.cfg.BufferSize)
+	s.done = make(chan struct{})
+	s.once = sync.Once{}
+	go s.loop()
+}
+
+// TestDone is called when a test has been completed. The lines of a
+// test completed after RunnerDone are dropped.
+func (s *StreamHandler) TestDone(res spidomtr.TestResult) {
+	lines := s.encode(s.runner, res)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		atomic.AddInt64(&s.dropped, int64(len(lines)))
+		return
+	}
+	for _, line := range lines {
+		select {
+		case s.lines <- line:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+		}
+	}
+}
+
+// RunnerDone is called when the runner has run all tests. It blocks
+// until all queued metric lines have been sent.
+func (s *StreamHandler) RunnerDone(spidomtr.Result) {
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		close(s.lines)
+		s.mu.Unlock()
+
+		<-s.done
+		if s.closer != nil {
+			if err := s.closer(); err != nil {
+				log.Printf("stream: %v", err)
+			}
+		}
+	})
+}
+
+func (s *StreamHandler) loop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]byte, 0, s.cfg.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.send(batch); err != nil {
+			log.Printf("stream: %v", err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case line, ok := <-s.lines:
+			if !ok {
+				flush()
+				return
+			}
+			if len(batch) > 0 && len(batch)+len(line)+1 > s.cfg.BatchSize {
+				flush()
+			}
+			batch = append(batch, line...)
+			batch = append(batch, '\n')
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// sortedNames returns the names of the metrics in m in order
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,191 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/handlers"
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+	"github.com/stretchr/testify/require"
+)
+
+func streamTests() []testunit.TestUnit {
+	return []testunit.TestUnit{
+		testunit.New(testunit.ID("passing_test")),
+		testunit.New(
+			testunit.ID("failing_test"),
+			testunit.Test(func(context.Context, []interface{}) ([]interface{}, error) {
+				return nil, errors.New(`whooops, "bad"`)
+			}),
+		),
+	}
+}
+
+func runStream(h spidomtr.RunnerHandler) spidomtr.Result {
+	runner := spidomtr.NewRunner(
+		spidomtr.ID("stream runner"),
+		spidomtr.Handlers(h),
+		spidomtr.Iterations(10),
+		spidomtr.ShowLogo(false),
+		spidomtr.ShowSummary(false),
+		spidomtr.Users(2),
+	)
+	return runner.Run(context.Background(), streamTests()...)
+}
+
+func TestInflux(t *testing.T) {
+	t.Run("writer", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		h := handlers.Influx(buf, handlers.BatchSize(256))
+		runStream(h)
+		require.Equal(t, int64(0), h.Dropped())
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 40)
+		for _, line := range lines {
+			require.True(t, strings.HasPrefix(line, `spidomtr,runner=stream\ runner,test=`), line)
+		}
+		require.Contains(t, buf.String(), `,test=failing_test,outcome=fail duration=0i`)
+		require.Contains(t, buf.String(), `,error="whooops, \"bad\""`)
+	})
+	t.Run("http", func(t *testing.T) {
+		mux := &sync.Mutex{}
+		var lines []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			mux.Lock()
+			defer mux.Unlock()
+			lines = append(lines, strings.Split(strings.TrimSpace(string(b)), "\n")...)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		runStream(handlers.InfluxHTTP(server.URL, handlers.Prefix("load")))
+
+		mux.Lock()
+		defer mux.Unlock()
+		require.Len(t, lines, 40)
+		require.True(t, strings.HasPrefix(lines[0], "load,"))
+	})
+	t.Run("metrics", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		h := handlers.Influx(buf)
+		h.RunnerStarted("id", "", 1)
+		h.TestDone(metricsResult())
+		h.RunnerDone(spidomtr.Result{})
+
+		require.Equal(t, []string{
+			"spidomtr,runner=id,test=test,outcome=pass duration=0i,user=0i,iteration=0i 1000000000",
+			"spidomtr_metrics,runner=id,test=test,metric=bytes,kind=counter value=10i 1000000000",
+			"spidomtr_metrics,runner=id,test=test,metric=queue,kind=gauge value=3.5 1000000000",
+			"spidomtr_metrics,runner=id,test=test,metric=items,kind=histogram count=2i,sum=3,min=1,max=2 1000000000",
+			"spidomtr_metrics,runner=id,test=test,metric=wait,kind=trend count=1i,sum=1000000,min=1000000,max=1000000 1000000000",
+		}, strings.Split(strings.TrimSpace(buf.String()), "\n"))
+	})
+	t.Run("drops lines when buffer is full", func(t *testing.T) {
+		block := make(chan struct{})
+		h := handlers.Influx(writerFunc(func(p []byte) (int, error) {
+			<-block
+			return len(p), nil
+		}), handlers.BatchSize(1), handlers.BufferSize(1))
+
+		h.RunnerStarted("id", "", 20)
+		for i := 0; i < 20; i++ {
+			h.TestDone(spidomtr.TestResult{ID: "test", Outcome: testunit.Pass})
+		}
+		close(block)
+		h.RunnerDone(spidomtr.Result{})
+		require.Greater(t, h.Dropped(), int64(0))
+	})
+	t.Run("done after runner", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		h := handlers.Influx(buf)
+
+		h.RunnerStarted("id", "", 1)
+		h.RunnerDone(spidomtr.Result{})
+		require.NotPanics(t, func() {
+			h.TestDone(spidomtr.TestResult{ID: "test", Outcome: testunit.Pass})
+		})
+		require.Equal(t, int64(1), h.Dropped())
+		require.Zero(t, buf.Len())
+	})
+}
+
+func TestStatsD(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	runStream(handlers.StatsD(conn.LocalAddr().String(), handlers.FlushInterval(10*time.Millisecond)))
+
+	var lines []string
+	buf := make([]byte, 64*1024)
+	for len(lines) < 60 {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		require.LessOrEqual(t, n, handlers.DefaultStatsDBatchSize)
+		lines = append(lines, strings.Split(strings.TrimSpace(string(buf[:n])), "\n")...)
+	}
+
+	require.Len(t, lines, 60)
+	require.Contains(t, lines, "spidomtr.tests:1|c|#runner:stream runner,test:failing_test,outcome:fail")
+	for _, line := range lines {
+		if strings.HasPrefix(line, "spidomtr.duration:") {
+			require.True(t, strings.HasSuffix(line, "|#runner:stream runner,test:passing_test,outcome:pass"), line)
+		}
+	}
+}
+
+func TestStatsDMetrics(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	h := handlers.StatsD(conn.LocalAddr().String())
+	h.RunnerStarted("id", "", 1)
+	h.TestDone(metricsResult())
+	h.RunnerDone(spidomtr.Result{})
+
+	buf := make([]byte, 64*1024)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"spidomtr.tests:1|c|#runner:id,test:test,outcome:pass",
+		"spidomtr.duration:0|ms|#runner:id,test:test,outcome:pass",
+		"spidomtr.metrics.bytes:10|c|#runner:id,test:test,outcome:pass",
+		"spidomtr.metrics.queue:3.5|g|#runner:id,test:test,outcome:pass",
+		"spidomtr.metrics.items:1|h|#runner:id,test:test,outcome:pass",
+		"spidomtr.metrics.items:2|h|#runner:id,test:test,outcome:pass",
+		"spidomtr.metrics.wait:1|ms|#runner:id,test:test,outcome:pass",
+	}, strings.Split(strings.TrimSpace(string(buf[:n])), "\n"))
+}
+
+func metricsResult() spidomtr.TestResult {
+	return spidomtr.TestResult{
+		Counters:   map[string]int64{"bytes": 10},
+		Date:       time.Unix(1, 0),
+		Gauges:     map[string]float64{"queue": 3.5},
+		Histograms: map[string][]float64{"items": {1, 2}},
+		ID:         "test",
+		Outcome:    testunit.Pass,
+		Trends:     map[string][]time.Duration{"wait": {time.Millisecond}},
+	}
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
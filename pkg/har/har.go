@@ -0,0 +1,283 @@
+// Package har imports HAR (HTTP Archive) files, e.g. browser sessions
+// recorded with the developer tools, as a sequence of HTTP test units.
+// A runner runs the test units in order for each user and iteration, so
+// each user replays the recorded journey.
+package har
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/spider-pigs/spidomtr/pkg/httpunit"
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+)
+
+// HAR is the root of a HAR file. Only the parts needed to replay the
+// requests are decoded.
+type HAR struct {
+	Log Log `json:"log"`
+}
+
+// Log type
+type Log struct {
+	Entries []Entry `json:"entries"`
+}
+
+// Entry is a recorded request and its response
+type Entry struct {
+	Request         Request   `json:"request"`
+	Response        Response  `json:"response"`
+	StartedDateTime time.Time `json:"startedDateTime"`
+	// Time is the total time of the request in milliseconds
+	Time float64 `json:"time"`
+}
+
+// Request type
+type Request struct {
+	Headers  []NameValue `json:"headers"`
+	Method   string      `json:"method"`
+	PostData *PostData   `json:"postData"`
+	URL      string      `json:"url"`
+}
+
+// PostData type
+type PostData struct {
+	MimeType string      `json:"mimeType"`
+	Params   []NameValue `json:"params"`
+	Text     string      `json:"text"`
+}
+
+// Response type
+type Response struct {
+	Content Content `json:"content"`
+	Status  int     `json:"status"`
+}
+
+// Content type
+type Content struct {
+	MimeType string `json:"mimeType"`
+}
+
+// NameValue is a header or a form parameter
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Config type
+type Config struct {
+	DropHosts    []string
+	DropStatic   bool
+	Filter       func(Entry) bool
+	HTTPOptions  []httpunit.Option
+	MaxThinkTime time.Duration
+	ThinkTimes   bool
+}
+
+// Option type
+type Option func(*Config)
+
+// DropHosts drops the requests to hosts, e.g. "www.google-analytics.com".
+// A host also matches its subdomains.
+func DropHosts(hosts ...string) Option {
+	return func(cfg *Config) {
+		cfg.DropHosts = append(cfg.DropHosts, hosts...)
+	}
+}
+
+// DropStatic drops requests for static assets, i.e. images, fonts,
+// stylesheets, scripts and media, by file extension or response content
+// type
+func DropStatic() Option {
+	return func(cfg *Config) {
+		cfg.DropStatic = true
+	}
+}
+
+// Filter drops the entries f returns false for
+func Filter(f func(Entry) bool) Option {
+	return func(cfg *Config) {
+		cfg.Filter = f
+	}
+}
+
+// HTTPOptions adds options to each test unit, e.g. httpunit.Templates
+func HTTPOptions(options ...httpunit.Option) Option {
+	return func(cfg *Config) {
+		cfg.HTTPOptions = append(cfg.HTTPOptions, options...)
+	}
+}
+
+// ThinkTimes replays the recorded time between a response and the next
+// request, capped at max if max is above 0. Overlapping requests, e.g.
+// the assets of a page, have no think time.
+func ThinkTimes(max time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.MaxThinkTime = max
+		cfg.ThinkTimes = true
+	}
+}
+
+// Load imports the HAR file name, see Read
+func Load(name string, options ...Option) ([]testunit.TestUnit, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tests, err := Read(f, options...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return tests, nil
+}
+
+// Read imports a HAR file as test units, one per request in recorded
+// order, with the recorded method, URL, headers and body. The test
+// units are named "<n> <method> <url>", where n is the position of the
+// request, and expect the recorded response status. Redirects are not
+// followed, since the browser records them as requests of their own.
+// Requests that got no response, e.g. blocked or aborted ones, are
+// dropped.
+func Read(r io.Reader, options ...Option) ([]testunit.TestUnit, error) {
+	cfg := &Config{}
+	for _, opt := range options {
+		opt(cfg)
+	}
+
+	var har HAR
+	if err := json.NewDecoder(r).Decode(&har); err != nil {
+		return nil, err
+	}
+
+	// The test units share a connection pool, like a browser
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 0
+	transport.MaxIdleConnsPerHost = 100
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Transport: transport,
+	}
+
+	tests := make([]testunit.TestUnit, 0, len(har.Log.Entries))
+	var prevEnd time.Time
+	for i, e := range har.Log.Entries {
+		u, err := url.Parse(e.Request.URL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("entry %d: invalid url %q", i, e.Request.URL)
+		}
+		if e.Response.Status == 0 || cfg.dropped(e, u) {
+			continue
+		}
+
+		opts := []httpunit.Option{
+			httpunit.Client(client),
+			httpunit.Expect(httpunit.Status(e.Response.Status)),
+			httpunit.ID(fmt.Sprintf("%03d %s %s", len(tests)+1, e.Request.Method, e.Request.URL)),
+		}
+		for _, h := range e.Request.Headers {
+			if !skipHeader(h.Name) {
+				opts = append(opts, httpunit.Header(h.Name, h.Value))
+			}
+		}
+		if body, ok := postBody(e.Request.PostData); ok {
+			opts = append(opts, httpunit.Body(body))
+		}
+
+		// Think time is the gap between the end of the previous
+		// request and the start of this one
+		if cfg.ThinkTimes && !prevEnd.IsZero() {
+			if d := e.StartedDateTime.Sub(prevEnd); d > 0 {
+				if cfg.MaxThinkTime > 0 && d > cfg.MaxThinkTime {
+					d = cfg.MaxThinkTime
+				}
+				opts = append(opts, httpunit.ThinkTime(d))
+			}
+		}
+		end := e.StartedDateTime.Add(time.Duration(e.Time * float64(time.Millisecond)))
+		if end.After(prevEnd) {
+			prevEnd = end
+		}
+
+		opts = append(opts, cfg.HTTPOptions...)
+		tests = append(tests, httpunit.New(e.Request.Method, e.Request.URL, opts...))
+	}
+	return tests, nil
+}
+
+func (cfg *Config) dropped(e Entry, u *url.URL) bool {
+	host := u.Hostname()
+	for _, h := range cfg.DropHosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	if cfg.DropStatic && isStatic(e, u) {
+		return true
+	}
+	return cfg.Filter != nil && !cfg.Filter(e)
+}
+
+var staticExts = map[string]bool{
+	".avif": true, ".bmp": true, ".css": true, ".eot": true, ".gif": true,
+	".ico": true, ".jpeg": true, ".jpg": true, ".js": true, ".map": true,
+	".mjs": true, ".mp3": true, ".mp4": true, ".otf": true, ".png": true,
+	".svg": true, ".ttf": true, ".webm": true, ".webp": true, ".woff": true,
+	".woff2": true,
+}
+
+func isStatic(e Entry, u *url.URL) bool {
+	if staticExts[strings.ToLower(path.Ext(u.Path))] {
+		return true
+	}
+	mime, _, _ := strings.Cut(strings.ToLower(e.Response.Content.MimeType), ";")
+	mime = strings.TrimSpace(mime)
+	for _, prefix := range []string{"image/", "font/", "audio/", "video/"} {
+		if strings.HasPrefix(mime, prefix) {
+			return true
+		}
+	}
+	switch mime {
+	case "text/css", "text/javascript", "application/javascript", "application/x-javascript":
+		return true
+	}
+	return false
+}
+
+// skipHeader returns if a recorded header must not be replayed, i.e.
+// HTTP/2 pseudo-headers and headers set by the transport
+func skipHeader(name string) bool {
+	if strings.HasPrefix(name, ":") {
+		return true
+	}
+	switch http.CanonicalHeaderKey(name) {
+	case "Connection", "Content-Length", "Host", "Keep-Alive", "Transfer-Encoding", "Upgrade":
+		return true
+	}
+	return false
+}
+
+// postBody returns the recorded request body, encoding form parameters
+// if the text is missing
+func postBody(pd *PostData) ([]byte, bool) {
+	if pd == nil {
+		return nil, false
+	}
+	if pd.Text != "" || len(pd.Params) == 0 {
+		return []byte(pd.Text), true
+	}
+	form := make(url.Values)
+	for _, p := range pd.Params {
+		form.Add(p.Name, p.Value)
+	}
+	return []byte(form.Encode()), true
+}
@@ -0,0 +1,184 @@
+package har_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/har"
+	"github.com/stretchr/testify/require"
+)
+
+const session = `{
+  "log": {
+    "version": "1.2",
+    "entries": [
+      {
+        "startedDateTime": "2024-05-01T10:00:00.000Z",
+        "time": 10,
+        "request": {
+          "method": "GET",
+          "url": "{{host}}/page",
+          "headers": [
+            {"name": ":authority", "value": "example.com"},
+            {"name": "Cookie", "value": "session=spiderpig"}
+          ]
+        },
+        "response": {"status": 200, "content": {"mimeType": "text/html; charset=utf-8"}}
+      },
+      {
+        "startedDateTime": "2024-05-01T10:00:00.005Z",
+        "time": 10,
+        "request": {"method": "GET", "url": "{{host}}/app.js", "headers": []},
+        "response": {"status": 200, "content": {"mimeType": "application/javascript"}}
+      },
+      {
+        "startedDateTime": "2024-05-01T10:00:00.005Z",
+        "time": 10,
+        "request": {"method": "GET", "url": "{{host}}/logo", "headers": []},
+        "response": {"status": 200, "content": {"mimeType": "image/png"}}
+      },
+      {
+        "startedDateTime": "2024-05-01T10:00:00.006Z",
+        "time": 10,
+        "request": {"method": "POST", "url": "https://www.google-analytics.com/collect", "headers": []},
+        "response": {"status": 204, "content": {}}
+      },
+      {
+        "startedDateTime": "2024-05-01T10:00:03.000Z",
+        "time": 10,
+        "request": {
+          "method": "POST",
+          "url": "{{host}}/login",
+          "headers": [
+            {"name": "Content-Type", "value": "application/x-www-form-urlencoded"},
+            {"name": "Content-Length", "value": "999"}
+          ],
+          "postData": {
+            "mimeType": "application/x-www-form-urlencoded",
+            "params": [{"name": "user", "value": "pig"}, {"name": "password", "value": "spider"}]
+          }
+        },
+        "response": {"status": 302, "content": {}}
+      },
+      {
+        "startedDateTime": "2024-05-01T10:00:03.010Z",
+        "time": 10,
+        "request": {"method": "GET", "url": "{{host}}/home", "headers": []},
+        "response": {"status": 200, "content": {"mimeType": "text/html"}}
+      },
+      {
+        "startedDateTime": "2024-05-01T10:00:03.010Z",
+        "time": 0,
+        "request": {"method": "GET", "url": "{{host}}/blocked", "headers": []},
+        "response": {"status": 0, "content": {}}
+      }
+    ]
+  }
+}`
+
+type request struct {
+	body   string
+	cookie string
+	method string
+	path   string
+}
+
+func newServer(t *testing.T) (*httptest.Server, *[]request) {
+	var mu sync.Mutex
+	var requests []request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, request{
+			body:   string(b),
+			cookie: r.Header.Get("Cookie"),
+			method: r.Method,
+			path:   r.URL.Path,
+		})
+		mu.Unlock()
+		if r.URL.Path == "/login" {
+			http.Redirect(w, r, "/home", http.StatusFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestRead(t *testing.T) {
+	srv, requests := newServer(t)
+
+	tests, err := har.Read(strings.NewReader(strings.ReplaceAll(session, "{{host}}", srv.URL)),
+		har.DropHosts("google-analytics.com"),
+		har.DropStatic(),
+		har.ThinkTimes(50*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	ids := make([]string, len(tests))
+	for i, test := range tests {
+		ids[i] = test.ID()
+	}
+	require.Equal(t, []string{
+		"001 GET " + srv.URL + "/page",
+		"002 POST " + srv.URL + "/login",
+		"003 GET " + srv.URL + "/home",
+	}, ids)
+
+	runner := spidomtr.NewRunner(
+		spidomtr.ShowLogo(false),
+		spidomtr.ShowSummary(false),
+	)
+	start := time.Now()
+	res := runner.Run(context.Background(), tests...)
+	require.Equal(t, 3, res.Stats.Passed, res.Stats.Errorm)
+	require.GreaterOrEqual(t, int64(time.Since(start)), int64(50*time.Millisecond))
+
+	require.Equal(t, []request{
+		{cookie: "session=spiderpig", method: "GET", path: "/page"},
+		{body: "password=spider&user=pig", method: "POST", path: "/login"},
+		{method: "GET", path: "/home"},
+	}, *requests)
+}
+
+func TestReadAll(t *testing.T) {
+	srv, requests := newServer(t)
+
+	tests, err := har.Read(strings.NewReader(strings.ReplaceAll(session, "{{host}}", srv.URL)),
+		har.DropHosts("www.google-analytics.com"),
+		har.Filter(func(e har.Entry) bool {
+			return e.Request.Method == http.MethodGet
+		}),
+	)
+	require.NoError(t, err)
+	require.Len(t, tests, 4)
+
+	runner := spidomtr.NewRunner(
+		spidomtr.Iterations(2),
+		spidomtr.ShowLogo(false),
+		spidomtr.ShowSummary(false),
+		spidomtr.Users(3),
+	)
+	res := runner.Run(context.Background(), tests...)
+	require.Equal(t, 24, res.Stats.Passed, res.Stats.Errorm)
+	require.Len(t, *requests, 24)
+}
+
+func TestLoad(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "session.har")
+	require.NoError(t, os.WriteFile(name, []byte(`{"log": {"entries": [{"request": {"url": "/relative"}}]}}`), 0o644))
+
+	_, err := har.Load(name)
+	require.EqualError(t, err, name+`: entry 0: invalid url "/relative"`)
+
+	_, err = har.Load(filepath.Join(t.TempDir(), "missing.har"))
+	require.Error(t, err)
+}
@@ -0,0 +1,3 @@
+// Package httpunit builds spidomtr test units from HTTP request
+// templates
+package httpunit
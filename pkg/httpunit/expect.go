@@ -0,0 +1,172 @@
+package httpunit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Expectation is a check on a response
+type Expectation struct {
+	status bool
+	check  func(*http.Response, []byte) error
+}
+
+// Func creates an expectation from a func returning an error if the
+// response is not the expected one
+func Func(f func(resp *http.Response, body []byte) error) Expectation {
+	return Expectation{check: f}
+}
+
+func hasStatusExpectation(expectations []Expectation) bool {
+	for _, e := range expectations {
+		if e.status {
+			return true
+		}
+	}
+	return false
+}
+
+// Status expects any of the given status codes
+func Status(codes ...int) Expectation {
+	return Expectation{
+		status: true,
+		check: func(resp *http.Response, _ []byte) error {
+			for _, code := range codes {
+				if resp.StatusCode == code {
+					return nil
+				}
+			}
+			return fmt.Errorf("unexpected status %s", resp.Status)
+		},
+	}
+}
+
+// Status2xx expects a 2xx status code
+func Status2xx() Expectation {
+	return Expectation{
+		status: true,
+		check: func(resp *http.Response, _ []byte) error {
+			if resp.StatusCode/100 != 2 {
+				return fmt.Errorf("unexpected status %s", resp.Status)
+			}
+			return nil
+		},
+	}
+}
+
+// HeaderEquals expects the response header key to have value
+func HeaderEquals(key, value string) Expectation {
+	return Expectation{
+		check: func(resp *http.Response, _ []byte) error {
+			if v := resp.Header.Get(key); v != value {
+				return fmt.Errorf("unexpected header %s: %q", key, v)
+			}
+			return nil
+		},
+	}
+}
+
+// HeaderMatches expects the response header key to match the regular
+// expression pattern
+func HeaderMatches(key, pattern string) Expectation {
+	re := regexp.MustCompile(pattern)
+	return Expectation{
+		check: func(resp *http.Response, _ []byte) error {
+			if v := resp.Header.Get(key); !re.MatchString(v) {
+				return fmt.Errorf("unexpected header %s: %q", key, v)
+			}
+			return nil
+		},
+	}
+}
+
+// BodyContains expects the response body to contain s
+func BodyContains(s string) Expectation {
+	return Expectation{
+		check: func(_ *http.Response, body []byte) error {
+			if !bytes.Contains(body, []byte(s)) {
+				return fmt.Errorf("body does not contain %q", s)
+			}
+			return nil
+		},
+	}
+}
+
+// BodyMatches expects the response body to match the regular
+// expression pattern
+func BodyMatches(pattern string) Expectation {
+	re := regexp.MustCompile(pattern)
+	return Expectation{
+		check: func(_ *http.Response, body []byte) error {
+			if !re.Match(body) {
+				return fmt.Errorf("body does not match %q", pattern)
+			}
+			return nil
+		},
+	}
+}
+
+// JSONPath expects the JSON response body to have value at path. The
+// path is a dot separated list of object keys and array indexes, e.g.
+// "$.items[0].id" or "items.0.id".
+func JSONPath(path string, value interface{}) Expectation {
+	// Normalize the expected value to what encoding/json decodes to
+	var expected interface{}
+	b, err := json.Marshal(value)
+	if err != nil {
+		panic("invalid json path value: " + err.Error())
+	}
+	json.Unmarshal(b, &expected)
+
+	return Expectation{
+		check: func(_ *http.Response, body []byte) error {
+			var doc interface{}
+			if err := json.Unmarshal(body, &doc); err != nil {
+				return fmt.Errorf("body is not json: %v", err)
+			}
+			v, ok := lookup(doc, path)
+			if !ok {
+				return fmt.Errorf("json path %s not found", path)
+			}
+			if !reflect.DeepEqual(v, expected) {
+				return fmt.Errorf("json path %s is %v, expected %v", path, v, expected)
+			}
+			return nil
+		},
+	}
+}
+
+func lookup(doc interface{}, path string) (interface{}, bool) {
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return doc, true
+	}
+
+	v := doc
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			child, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			v = child
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
@@ -0,0 +1,427 @@
+package httpunit
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+)
+
+// Counters reported for each request
+const (
+	// BytesCounter counts response body bytes
+	BytesCounter = "http.bytes"
+	// ConnNewCounter counts requests sent on a new connection
+	ConnNewCounter = "http.conn.new"
+	// ConnReusedCounter counts requests sent on a reused connection
+	ConnReusedCounter = "http.conn.reused"
+	// StatusCounterPrefix prefixes the counter of each status code,
+	// e.g. "http.status.200"
+	StatusCounterPrefix = "http.status."
+)
+
+// Tags set on the result of each request
+const (
+	// StatusTag is the response status code, e.g. "200"
+	StatusTag = "http.status"
+)
+
+// Timings reported for each request
+const (
+	// DNSTiming is the time spent on the DNS lookup
+	DNSTiming = "http.dns"
+	// ConnectTiming is the time spent on establishing the TCP
+	// connection
+	ConnectTiming = "http.connect"
+	// TLSTiming is the time spent on the TLS handshake
+	TLSTiming = "http.tls"
+	// TTFBTiming is the time from writing the request until the first
+	// response byte is received
+	TTFBTiming = "http.ttfb"
+	// TransferTiming is the time spent on reading the response body
+	// after the first response byte is received
+	TransferTiming = "http.transfer"
+)
+
+// Config type
+type Config struct {
+	Body                []byte
+	Client              *http.Client
+	DisableKeepAlives   bool
+	Enabled             func() (bool, string)
+	Expectations        []Expectation
+	Header              http.Header
+	ID                  string
+	IdleConnTimeout     time.Duration
+	MaxConnsPerHost     int
+	MaxIdleConnsPerHost int
+	Method              string
+	Tags                map[string]string
+	Templates           bool
+	ThinkTime           time.Duration
+	URL                 string
+	Vars                map[string]string
+}
+
+// Data is the data templated requests are executed with, see Templates
+type Data struct {
+	ID        string
+	Iteration int
+	Record    interface{}
+	User      int
+	Vars      map[string]string
+}
+
+// Option type
+type Option func(*Config)
+
+// Templates makes the URL, header values and body text/templates
+// executed with Data for each request, e.g. "/users/{{.User}}" or
+// "{{.Vars.host}}/items". Vars are available to the templates as
+// .Vars, and the feeder record of the iteration as .Record.
+func Templates(vars map[string]string) Option {
+	return func(cfg *Config) {
+		cfg.Templates = true
+		cfg.Vars = vars
+	}
+}
+
+// Body sets the request body
+func Body(b []byte) Option {
+	return func(cfg *Config) {
+		cfg.Body = b
+	}
+}
+
+// Client sets the http client to use. Connection pool options are
+// ignored when a client is set.
+func Client(c *http.Client) Option {
+	return func(cfg *Config) {
+		cfg.Client = c
+	}
+}
+
+// DisableKeepAlives disables keep-alive, so that each request is sent
+// on a new connection
+func DisableKeepAlives(b bool) Option {
+	return func(cfg *Config) {
+		cfg.DisableKeepAlives = b
+	}
+}
+
+// Enabled adds enabled func
+func Enabled(f func() (bool, string)) Option {
+	return func(cfg *Config) {
+		cfg.Enabled = f
+	}
+}
+
+// Expect adds response expectations. If no status expectation is
+// added, any 2xx status is expected.
+func Expect(e ...Expectation) Option {
+	return func(cfg *Config) {
+		cfg.Expectations = append(cfg.Expectations, e...)
+	}
+}
+
+// Header adds a request header
+func Header(key, value string) Option {
+	return func(cfg *Config) {
+		cfg.Header.Add(key, value)
+	}
+}
+
+// ID sets the test unit id (defaults to "<method> <url>")
+func ID(id string) Option {
+	return func(cfg *Config) {
+		cfg.ID = id
+	}
+}
+
+// IdleConnTimeout sets how long idle connections are kept in the pool
+// (defaults to 90 secs)
+func IdleConnTimeout(d time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.IdleConnTimeout = d
+	}
+}
+
+// MaxConnsPerHost limits the number of connections per host (defaults
+// to no limit)
+func MaxConnsPerHost(n int) Option {
+	return func(cfg *Config) {
+		cfg.MaxConnsPerHost = n
+	}
+}
+
+// MaxIdleConnsPerHost sets the number of idle connections kept per
+// host (defaults to 100)
+func MaxIdleConnsPerHost(n int) Option {
+	return func(cfg *Config) {
+		cfg.MaxIdleConnsPerHost = n
+	}
+}
+
+// Tags adds tags to the results of the test, e.g. {"endpoint": "items"}.
+// The status code of the response is tagged as StatusTag.
+func Tags(tags map[string]string) Option {
+	return func(cfg *Config) {
+		if cfg.Tags == nil {
+			cfg.Tags = make(map[string]string, len(tags))
+		}
+		for k, v := range tags {
+			cfg.Tags[k] = v
+		}
+	}
+}
+
+// ThinkTime waits d before sending the request, e.g. to replay the time
+// a user spent on a page. The wait is neither timed nor counted against
+// the test timeout.
+func ThinkTime(d time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.ThinkTime = d
+	}
+}
+
+// New constructs a test unit sending a request to url. Response bytes,
+// status codes and connection reuse are counted in the test result,
+// along with the timings of the DNS, connect, TLS, time to first byte
+// and transfer phases of the request.
+func New(method, url string, options ...Option) *testunit.TestAssembly {
+	cfg := &Config{
+		Enabled:             func() (bool, string) { return true, "" },
+		Header:              make(http.Header),
+		ID:                  method + " " + url,
+		IdleConnTimeout:     90 * time.Second,
+		MaxIdleConnsPerHost: 100,
+		Method:              method,
+		URL:                 url,
+	}
+
+	for _, opt := range options {
+		opt(cfg)
+	}
+
+	if !hasStatusExpectation(cfg.Expectations) {
+		cfg.Expectations = append([]Expectation{Status2xx()}, cfg.Expectations...)
+	}
+
+	client := cfg.Client
+	if client == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DisableKeepAlives = cfg.DisableKeepAlives
+		transport.IdleConnTimeout = cfg.IdleConnTimeout
+		transport.MaxConnsPerHost = cfg.MaxConnsPerHost
+		transport.MaxIdleConns = 0
+		transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+		client = &http.Client{Transport: transport}
+	}
+
+	build := func(ctx context.Context) (*http.Request, error) {
+		return newRequest(ctx, cfg.Method, cfg.URL, cfg.Header, cfg.Body)
+	}
+	if cfg.Templates {
+		build = templated(cfg)
+	}
+
+	return testunit.New(
+		testunit.ID(cfg.ID),
+		testunit.Enabled(cfg.Enabled),
+		testunit.Tags(cfg.Tags),
+		testunit.ThinkTime(cfg.ThinkTime),
+		testunit.Test(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			req, err := build(ctx)
+			if err != nil {
+				return args, err
+			}
+			return args, do(ctx, client, req, cfg.Expectations)
+		}),
+	)
+}
+
+func newRequest(ctx context.Context, method, url string, header http.Header, b []byte) (*http.Request, error) {
+	var body io.Reader
+	if b != nil {
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if host := header.Get("Host"); host != "" {
+		req.Host = host
+	}
+	return req, nil
+}
+
+// templated returns a func building requests from the URL, header and
+// body templates of cfg. It panics if a template is invalid.
+func templated(cfg *Config) func(ctx context.Context) (*http.Request, error) {
+	urlTmpl := template.Must(template.New("url").Parse(cfg.URL))
+	bodyTmpl := template.Must(template.New("body").Parse(string(cfg.Body)))
+	headerTmpls := make(map[string][]*template.Template, len(cfg.Header))
+	for k, vs := range cfg.Header {
+		for _, v := range vs {
+			headerTmpls[k] = append(headerTmpls[k], template.Must(template.New(k).Parse(v)))
+		}
+	}
+
+	return func(ctx context.Context) (*http.Request, error) {
+		data := Data{
+			ID:        cfg.ID,
+			Iteration: testunit.Iteration(ctx),
+			Record:    testunit.Record(ctx),
+			User:      testunit.User(ctx),
+			Vars:      cfg.Vars,
+		}
+
+		var sb strings.Builder
+		if err := urlTmpl.Execute(&sb, data); err != nil {
+			return nil, err
+		}
+		url := sb.String()
+
+		header := make(http.Header, len(headerTmpls))
+		for k, tmpls := range headerTmpls {
+			for _, tmpl := range tmpls {
+				sb.Reset()
+				if err := tmpl.Execute(&sb, data); err != nil {
+					return nil, err
+				}
+				header[k] = append(header[k], sb.String())
+			}
+		}
+
+		var body []byte
+		if cfg.Body != nil {
+			var b bytes.Buffer
+			if err := bodyTmpl.Execute(&b, data); err != nil {
+				return nil, err
+			}
+			body = b.Bytes()
+		}
+		return newRequest(ctx, cfg.Method, url, header, body)
+	}
+}
+
+func do(ctx context.Context, client *http.Client, req *http.Request, expectations []Expectation) error {
+	t := &tracer{ctx: ctx}
+	req = req.WithContext(httptrace.WithClientTrace(ctx, t.trace()))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	t.done()
+	testunit.Count(ctx, StatusCounterPrefix+strconv.Itoa(resp.StatusCode), 1)
+	testunit.Tag(ctx, StatusTag, strconv.Itoa(resp.StatusCode))
+	testunit.Count(ctx, BytesCounter, int64(len(b)))
+	if err != nil {
+		return err
+	}
+
+	for _, expect := range expectations {
+		if err := expect.check(resp, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tracer reports the connection reuse and phase timings of a request
+type tracer struct {
+	ctx context.Context
+
+	mu           sync.Mutex
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+}
+
+func (t *tracer) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			testunit.Timing(t.ctx, DNSTiming, time.Since(t.dnsStart))
+		},
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if err == nil {
+				testunit.Timing(t.ctx, ConnectTiming, time.Since(t.connectStart))
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if err == nil {
+				testunit.Timing(t.ctx, TLSTiming, time.Since(t.tlsStart))
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				testunit.Count(t.ctx, ConnReusedCounter, 1)
+			} else {
+				testunit.Count(t.ctx, ConnNewCounter, 1)
+			}
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.wroteRequest = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.firstByte = time.Now()
+			if !t.wroteRequest.IsZero() {
+				testunit.Timing(t.ctx, TTFBTiming, t.firstByte.Sub(t.wroteRequest))
+			}
+		},
+	}
+}
+
+func (t *tracer) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.firstByte.IsZero() {
+		testunit.Timing(t.ctx, TransferTiming, time.Since(t.firstByte))
+	}
+}
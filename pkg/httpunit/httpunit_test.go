@@ -0,0 +1,222 @@
+package httpunit_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/httpunit"
+	"github.com/stretchr/testify/require"
+)
+
+func newServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/items", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"items":[{"id":1,"name":"spider"},{"id":2,"name":"pig"}]}`))
+	})
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(b)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestHTTPUnit(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+
+	t.Run("expectations pass", func(t *testing.T) {
+		test := httpunit.New(http.MethodGet, server.URL+"/items",
+			httpunit.ID("items"),
+			httpunit.Header("Authorization", "Bearer token"),
+			httpunit.Expect(
+				httpunit.Status(http.StatusOK),
+				httpunit.HeaderEquals("Content-Type", "application/json"),
+				httpunit.BodyContains("spider"),
+				httpunit.BodyMatches(`"name":"p.g"`),
+				httpunit.JSONPath("$.items[1].id", 2),
+				httpunit.JSONPath("items.0.name", "spider"),
+			),
+		)
+
+		runner := spidomtr.NewRunner(
+			spidomtr.Iterations(10),
+			spidomtr.ShowLogo(false),
+			spidomtr.ShowSummary(false),
+		)
+		res := runner.Run(context.Background(), test)
+		require.Equal(t, 10, res.Stats.Passed, res.Stats.Errorm)
+
+		stats := res.TestStats["items"].Stats
+		require.Equal(t, int64(10), stats.Counters[httpunit.StatusCounterPrefix+"200"])
+		require.Equal(t, int64(10*58), stats.Counters[httpunit.BytesCounter])
+		require.Equal(t, int64(1), stats.Counters[httpunit.ConnNewCounter])
+		require.Equal(t, int64(9), stats.Counters[httpunit.ConnReusedCounter])
+		require.Equal(t, []string{"200"}, keys(res.GroupBy(httpunit.StatusTag)))
+	})
+	t.Run("expectations fail", func(t *testing.T) {
+		unauthorized := httpunit.New(http.MethodGet, server.URL+"/items")
+		wrongValue := httpunit.New(http.MethodGet, server.URL+"/items",
+			httpunit.ID("wrong value"),
+			httpunit.Header("Authorization", "Bearer token"),
+			httpunit.Expect(httpunit.JSONPath("items[0].id", 2)),
+		)
+
+		runner := spidomtr.NewRunner(
+			spidomtr.ShowLogo(false),
+			spidomtr.ShowSummary(false),
+		)
+		res := runner.Run(context.Background(), unauthorized, wrongValue)
+		require.Equal(t, 2, res.Stats.Errors)
+		require.Equal(t, []string{"200", "401"}, keys(res.GroupBy(httpunit.StatusTag)))
+		require.Equal(t, map[string]int{
+			"unexpected status 401 Unauthorized":     1,
+			"json path items[0].id is 1, expected 2": 1,
+		}, res.Stats.Errorm)
+		require.Equal(t, int64(1), res.Stats.Counters[httpunit.StatusCounterPrefix+"401"])
+	})
+	t.Run("request body without keep-alive", func(t *testing.T) {
+		test := httpunit.New(http.MethodPost, server.URL+"/echo",
+			httpunit.Body([]byte("hello")),
+			httpunit.DisableKeepAlives(true),
+			httpunit.Expect(
+				httpunit.Status(http.StatusCreated),
+				httpunit.BodyContains("hello"),
+			),
+		)
+
+		runner := spidomtr.NewRunner(
+			spidomtr.Iterations(5),
+			spidomtr.ShowLogo(false),
+			spidomtr.ShowSummary(false),
+		)
+		res := runner.Run(context.Background(), test)
+		require.Equal(t, 5, res.Stats.Passed, res.Stats.Errorm)
+		require.Equal(t, int64(5), res.Stats.Counters[httpunit.ConnNewCounter])
+		require.Zero(t, res.Stats.Counters[httpunit.ConnReusedCounter])
+	})
+	t.Run("phase timings", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}))
+		defer server.Close()
+
+		test := httpunit.New(http.MethodGet, server.URL,
+			httpunit.ID("tls"),
+			httpunit.Client(server.Client()),
+		)
+
+		runner := spidomtr.NewRunner(
+			spidomtr.Iterations(5),
+			spidomtr.ShowLogo(false),
+			spidomtr.ShowSummary(false),
+		)
+		res := runner.Run(context.Background(), test)
+		require.Equal(t, 5, res.Stats.Passed, res.Stats.Errorm)
+
+		phases := res.TestStats["tls"].Stats.Phases
+		require.Equal(t, 1, phases[httpunit.ConnectTiming].Count)
+		require.Equal(t, 1, phases[httpunit.TLSTiming].Count)
+		require.Equal(t, 5, phases[httpunit.TTFBTiming].Count)
+		require.Equal(t, 5, phases[httpunit.TransferTiming].Count)
+		require.NotContains(t, phases, httpunit.DNSTiming)
+		require.Greater(t, int64(phases[httpunit.TTFBTiming].Slowest), int64(0))
+		require.Equal(t, phases, res.Stats.Phases)
+	})
+	t.Run("ttfb excludes dialing", func(t *testing.T) {
+		dialer := &net.Dialer{}
+		client := &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					time.Sleep(50 * time.Millisecond)
+					return dialer.DialContext(ctx, network, addr)
+				},
+			},
+		}
+		test := httpunit.New(http.MethodGet, server.URL+"/echo",
+			httpunit.ID("slow dial"),
+			httpunit.Client(client),
+		)
+
+		runner := spidomtr.NewRunner(
+			spidomtr.ShowLogo(false),
+			spidomtr.ShowSummary(false),
+		)
+		res := runner.Run(context.Background(), test)
+		require.Equal(t, 1, res.Stats.Passed, res.Stats.Errorm)
+
+		phases := res.TestStats["slow dial"].Stats.Phases
+		require.Equal(t, 1, phases[httpunit.TTFBTiming].Count)
+		require.Less(t, int64(phases[httpunit.TTFBTiming].Slowest), int64(50*time.Millisecond))
+	})
+	t.Run("templates", func(t *testing.T) {
+		test := httpunit.New(http.MethodPost, "{{.Vars.host}}/echo",
+			httpunit.ID("echo"),
+			httpunit.Header("Authorization", "Bearer {{.Vars.token}}"),
+			httpunit.Body([]byte(`{"user":{{.User}},"iteration":{{.Iteration}}}`)),
+			httpunit.Templates(map[string]string{"host": server.URL, "token": "token"}),
+			httpunit.Expect(
+				httpunit.Status(http.StatusCreated),
+				httpunit.Func(func(resp *http.Response, body []byte) error {
+					require.Equal(t, "Bearer token", resp.Request.Header.Get("Authorization"))
+					return nil
+				}),
+				httpunit.JSONPath("user", 1),
+			),
+		)
+
+		runner := spidomtr.NewRunner(
+			spidomtr.Iterations(3),
+			spidomtr.ShowLogo(false),
+			spidomtr.ShowSummary(false),
+			spidomtr.Users(2),
+		)
+		res := runner.Run(context.Background(), test)
+		require.Equal(t, 3, res.Stats.Passed)
+		require.Equal(t, map[string]int{"json path user is 0, expected 1": 3}, res.Stats.Errorm)
+		// {"user":1,"iteration":0}
+		require.Equal(t, int64(6*24), res.Stats.Counters[httpunit.BytesCounter])
+	})
+	t.Run("think time", func(t *testing.T) {
+		test := httpunit.New(http.MethodPost, server.URL+"/echo",
+			httpunit.ID("echo"),
+			httpunit.ThinkTime(30*time.Millisecond),
+		)
+
+		runner := spidomtr.NewRunner(
+			spidomtr.Iterations(2),
+			spidomtr.ShowLogo(false),
+			spidomtr.ShowSummary(false),
+		)
+		start := time.Now()
+		res := runner.Run(context.Background(), test)
+		require.Equal(t, 2, res.Stats.Passed, res.Stats.Errorm)
+		require.GreaterOrEqual(t, int64(time.Since(start)), int64(60*time.Millisecond))
+
+		// The think time does not count against the timeout
+		res = runner.With(spidomtr.Timeout(10*time.Millisecond)).Run(context.Background(), test)
+		require.Equal(t, 2, res.Stats.Passed, res.Stats.Errorm)
+		require.Less(t, int64(res.Stats.Slowest), int64(30*time.Millisecond))
+	})
+}
+
+func keys(m map[string]spidomtr.TestStats) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,439 @@
+// Package plan loads declarative test plans from YAML or JSON files,
+// describing the runner options and the tests to run, e.g.
+//
+//	id: api
+//	users: 10
+//	iterations: 100
+//	thresholds:
+//	  - p99 < 500ms
+//	vars:
+//	  host: https://example.com
+//	tests:
+//	  - id: create-item
+//	    method: POST
+//	    url: "{{.Vars.host}}/items"
+//	    headers:
+//	      Content-Type: application/json
+//	    body: '{"name": "item-{{.User}}-{{.Iteration}}"}'
+//	    expect:
+//	      status: [201]
+//	      json:
+//	        $.name: item
+//	    thresholds:
+//	      - avg < 100ms
+//
+// URLs, header values and bodies are text/templates, see
+// httpunit.Templates.
+package plan
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/httpunit"
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+	"gopkg.in/yaml.v3"
+)
+
+// Plan type
+type Plan struct {
+	Description string            `yaml:"description"`
+	Duration    time.Duration     `yaml:"duration"`
+	ID          string            `yaml:"id"`
+	Iterations  int               `yaml:"iterations"`
+	Percentiles []int             `yaml:"percentiles"`
+	Rate        float64           `yaml:"rate"`
+	Tests       []Test            `yaml:"tests"`
+	Thresholds  []string          `yaml:"thresholds"`
+	Timeout     time.Duration     `yaml:"timeout"`
+	Users       int               `yaml:"users"`
+	Vars        map[string]string `yaml:"vars"`
+}
+
+// Test is a test unit of a plan. The only type of test is "http",
+// which is the default.
+type Test struct {
+	Body       string            `yaml:"body"`
+	Expect     Expect            `yaml:"expect"`
+	Headers    map[string]string `yaml:"headers"`
+	ID         string            `yaml:"id"`
+	Method     string            `yaml:"method"`
+	Tags       map[string]string `yaml:"tags"`
+	Thresholds []string          `yaml:"thresholds"`
+	Type       string            `yaml:"type"`
+	URL        string            `yaml:"url"`
+}
+
+// Expect holds the response expectations of an HTTP test. If no status
+// is expected, any 2xx status is expected.
+type Expect struct {
+	BodyContains string                 `yaml:"body_contains"`
+	BodyMatches  string                 `yaml:"body_matches"`
+	Headers      map[string]string      `yaml:"headers"`
+	HeadersMatch map[string]string      `yaml:"headers_match"`
+	JSON         map[string]interface{} `yaml:"json"`
+	Status       []int                  `yaml:"status"`
+}
+
+// Error is a validation error of a plan
+type Error struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.File != "" && e.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+	case e.File != "":
+		return e.File + ": " + e.Msg
+	case e.Line > 0:
+		return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+	}
+	return e.Msg
+}
+
+// Errors are the validation errors of a plan
+type Errors []*Error
+
+func (errs Errors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+var (
+	methodRe        = regexp.MustCompile(`^[A-Z]+$`)
+	templateErrorRe = regexp.MustCompile(`^template: [^:]*:\d+: (.*)$`)
+	yamlErrorRe     = regexp.MustCompile(`^line (\d+): (.*)$`)
+)
+
+// Load loads and validates the plan in the YAML or JSON file name
+func Load(name string) (*Plan, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Parse(b)
+	var errs Errors
+	if errors.As(err, &errs) {
+		for _, e := range errs {
+			e.File = name
+		}
+	}
+	return p, err
+}
+
+// Parse parses and validates a plan in YAML or JSON. Validation errors
+// are returned as Errors, pointing to the offending lines.
+func Parse(b []byte) (*Plan, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(b, &root); err != nil {
+		return nil, yamlErrors(err)
+	}
+
+	var p Plan
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); errors.Is(err, io.EOF) {
+		return nil, Errors{{Msg: "empty plan"}}
+	} else if err != nil {
+		return nil, yamlErrors(err)
+	}
+
+	v := validator{root: &root}
+	v.validate(&p)
+	if len(v.errs) > 0 {
+		return nil, v.errs
+	}
+	return &p, nil
+}
+
+// Runner constructs a runner with the options of the plan, followed by
+// options
+func (p *Plan) Runner(options ...spidomtr.Option) *spidomtr.Runner {
+	var opts []spidomtr.Option
+	if p.ID != "" {
+		opts = append(opts, spidomtr.ID(p.ID))
+	}
+	if p.Description != "" {
+		opts = append(opts, spidomtr.Description(p.Description))
+	}
+	if p.Duration > 0 {
+		opts = append(opts, spidomtr.Duration(p.Duration))
+	}
+	if p.Iterations > 0 {
+		opts = append(opts, spidomtr.Iterations(p.Iterations))
+	}
+	if len(p.Percentiles) > 0 {
+		opts = append(opts, spidomtr.Percentiles(p.Percentiles))
+	}
+	if p.Rate > 0 {
+		opts = append(opts, spidomtr.Rate(p.Rate))
+	}
+	if p.Timeout > 0 {
+		opts = append(opts, spidomtr.Timeout(p.Timeout))
+	}
+	if p.Users > 0 {
+		opts = append(opts, spidomtr.Users(p.Users))
+	}
+
+	var thresholds []spidomtr.Threshold
+	for _, expr := range p.Thresholds {
+		thresholds = append(thresholds, spidomtr.MustParseThreshold(expr))
+	}
+	for _, t := range p.Tests {
+		for _, expr := range t.Thresholds {
+			thresholds = append(thresholds, spidomtr.MustParseThreshold(expr).ForTest(t.id()))
+		}
+	}
+	if len(thresholds) > 0 {
+		opts = append(opts, spidomtr.Thresholds(thresholds...))
+	}
+
+	return spidomtr.NewRunner(append(opts, options...)...)
+}
+
+// TestUnits constructs the test units of the plan
+func (p *Plan) TestUnits() []testunit.TestUnit {
+	tests := make([]testunit.TestUnit, len(p.Tests))
+	for i, t := range p.Tests {
+		tests[i] = t.httpTest(p.Vars)
+	}
+	return tests
+}
+
+func (t Test) method() string {
+	if t.Method == "" {
+		return "GET"
+	}
+	return t.Method
+}
+
+func (t Test) id() string {
+	if t.ID == "" {
+		return t.method() + " " + t.URL
+	}
+	return t.ID
+}
+
+func (t Test) httpTest(vars map[string]string) *testunit.TestAssembly {
+	opts := []httpunit.Option{
+		httpunit.ID(t.id()),
+		httpunit.Tags(t.Tags),
+		httpunit.Templates(vars),
+	}
+	if t.Body != "" {
+		opts = append(opts, httpunit.Body([]byte(t.Body)))
+	}
+	for _, k := range sortedKeys(t.Headers) {
+		opts = append(opts, httpunit.Header(k, t.Headers[k]))
+	}
+
+	var expect []httpunit.Expectation
+	if len(t.Expect.Status) > 0 {
+		expect = append(expect, httpunit.Status(t.Expect.Status...))
+	}
+	for _, k := range sortedKeys(t.Expect.Headers) {
+		expect = append(expect, httpunit.HeaderEquals(k, t.Expect.Headers[k]))
+	}
+	for _, k := range sortedKeys(t.Expect.HeadersMatch) {
+		expect = append(expect, httpunit.HeaderMatches(k, t.Expect.HeadersMatch[k]))
+	}
+	if t.Expect.BodyContains != "" {
+		expect = append(expect, httpunit.BodyContains(t.Expect.BodyContains))
+	}
+	if t.Expect.BodyMatches != "" {
+		expect = append(expect, httpunit.BodyMatches(t.Expect.BodyMatches))
+	}
+	paths := make([]string, 0, len(t.Expect.JSON))
+	for path := range t.Expect.JSON {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		expect = append(expect, httpunit.JSONPath(path, t.Expect.JSON[path]))
+	}
+	opts = append(opts, httpunit.Expect(expect...))
+
+	return httpunit.New(t.method(), t.URL, opts...)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validator collects the validation errors of a plan, with the lines
+// looked up in the YAML node tree
+type validator struct {
+	errs Errors
+	root *yaml.Node
+}
+
+func (v *validator) errorf(path []interface{}, format string, args ...interface{}) {
+	v.errs = append(v.errs, &Error{Line: line(v.root, path...), Msg: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) validate(p *Plan) {
+	for _, f := range []struct {
+		name  string
+		value float64
+	}{
+		{"users", float64(p.Users)},
+		{"iterations", float64(p.Iterations)},
+		{"duration", float64(p.Duration)},
+		{"rate", p.Rate},
+		{"timeout", float64(p.Timeout)},
+	} {
+		if f.value < 0 {
+			v.errorf([]interface{}{f.name}, "%s must not be negative", f.name)
+		}
+	}
+	for i, pct := range p.Percentiles {
+		if pct <= 0 || pct > 100 {
+			v.errorf([]interface{}{"percentiles", i}, "percentile %d out of range 1-100", pct)
+		}
+	}
+	v.thresholds(p.Thresholds, "thresholds")
+
+	if len(p.Tests) == 0 {
+		v.errorf([]interface{}{"tests"}, "no tests")
+	}
+	ids := make(map[string]int)
+	for i, t := range p.Tests {
+		path := []interface{}{"tests", i}
+		if j, ok := ids[t.id()]; ok {
+			v.errorf(path, "duplicate test id %q, also used by test %d", t.id(), j+1)
+		}
+		ids[t.id()] = i
+		v.test(t, path)
+	}
+}
+
+func (v *validator) test(t Test, path []interface{}) {
+	at := func(keys ...interface{}) []interface{} {
+		return append(append([]interface{}{}, path...), keys...)
+	}
+
+	if t.Type != "" && t.Type != "http" {
+		v.errorf(at("type"), "unknown test type %q", t.Type)
+		return
+	}
+	if !methodRe.MatchString(t.method()) {
+		v.errorf(at("method"), "invalid method %q", t.Method)
+	}
+	if t.URL == "" {
+		v.errorf(path, "url missing")
+	}
+	v.template(t.URL, at("url"))
+	v.template(t.Body, at("body"))
+	for k, h := range t.Headers {
+		v.template(h, at("headers", k))
+	}
+
+	for i, code := range t.Expect.Status {
+		if code < 100 || code > 599 {
+			v.errorf(at("expect", "status", i), "invalid status %d", code)
+		}
+	}
+	if _, err := regexp.Compile(t.Expect.BodyMatches); err != nil {
+		v.errorf(at("expect", "body_matches"), "invalid pattern: %v", err)
+	}
+	for k, pattern := range t.Expect.HeadersMatch {
+		if _, err := regexp.Compile(pattern); err != nil {
+			v.errorf(at("expect", "headers_match", k), "invalid pattern: %v", err)
+		}
+	}
+	v.thresholds(t.Thresholds, at("thresholds")...)
+}
+
+func (v *validator) template(text string, path []interface{}) {
+	if _, err := template.New("").Parse(text); err != nil {
+		// Strip the template name and line, which the plan line replaces
+		msg := err.Error()
+		if m := templateErrorRe.FindStringSubmatch(msg); m != nil {
+			msg = m[1]
+		}
+		v.errorf(path, "invalid template: %s", msg)
+	}
+}
+
+func (v *validator) thresholds(exprs []string, path ...interface{}) {
+	for i, expr := range exprs {
+		if _, err := spidomtr.ParseThreshold(expr); err != nil {
+			v.errorf(append(append([]interface{}{}, path...), i), "%v", err)
+		}
+	}
+}
+
+// line returns the line of the node at path in the document root,
+// where path elements are mapping keys and sequence indexes. If the
+// path does not exist, the line of the deepest node found is returned.
+func line(root *yaml.Node, path ...interface{}) int {
+	n := root
+	if n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	for _, p := range path {
+		var next *yaml.Node
+		switch key := p.(type) {
+		case string:
+			if n.Kind == yaml.MappingNode {
+				for i := 0; i+1 < len(n.Content); i += 2 {
+					if n.Content[i].Value == key {
+						next = n.Content[i+1]
+						break
+					}
+				}
+			}
+		case int:
+			if n.Kind == yaml.SequenceNode && key < len(n.Content) {
+				next = n.Content[key]
+			}
+		}
+		if next == nil {
+			break
+		}
+		n = next
+	}
+	return n.Line
+}
+
+// yamlErrors converts a YAML error to Errors
+func yamlErrors(err error) error {
+	var te *yaml.TypeError
+	if errors.As(err, &te) {
+		errs := make(Errors, 0, len(te.Errors))
+		for _, msg := range te.Errors {
+			errs = append(errs, lineError(msg))
+		}
+		return errs
+	}
+	return Errors{lineError(strings.TrimPrefix(err.Error(), "yaml: "))}
+}
+
+func lineError(msg string) *Error {
+	if m := yamlErrorRe.FindStringSubmatch(msg); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		return &Error{Line: n, Msg: m[2]}
+	}
+	return &Error{Msg: msg}
+}
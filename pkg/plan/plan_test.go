@@ -0,0 +1,206 @@
+package plan_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/plan"
+	"github.com/stretchr/testify/require"
+)
+
+const yamlPlan = `
+id: items
+description: item api tests
+users: 2
+iterations: 3
+timeout: 5s
+percentiles: [50, 99]
+thresholds:
+  - error_rate < 1%
+vars:
+  token: secret
+tests:
+  - id: create-item
+    method: POST
+    url: "{{.Vars.host}}/items"
+    headers:
+      Authorization: Bearer {{.Vars.token}}
+    body: '{"name": "item-{{.User}}-{{.Iteration}}"}'
+    expect:
+      status: [201]
+      headers:
+        Content-Type: application/json
+      body_matches: item-\d-\d
+      json:
+        $.name: created
+    thresholds:
+      - p99 < 1s
+  - url: "{{.Vars.host}}/items"
+`
+
+func TestPlan(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(b))
+		mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"name": "created", "body": ` + strconvQuote(string(b)) + `}`))
+	}))
+	defer server.Close()
+
+	p, err := plan.Parse([]byte(yamlPlan))
+	require.NoError(t, err)
+	p.Vars["host"] = server.URL
+
+	runner := p.Runner(spidomtr.ShowLogo(false), spidomtr.ShowSummary(false))
+	cfg := runner.Config()
+	require.Equal(t, "items", cfg.ID)
+	require.Equal(t, "item api tests", cfg.Description)
+	require.Equal(t, 2, cfg.Users)
+	require.Equal(t, 3, cfg.Iterations)
+	require.Equal(t, 5*time.Second, cfg.Timeout)
+	require.Equal(t, []int{50, 99}, cfg.Percentiles)
+	require.Equal(t, []spidomtr.Threshold{
+		spidomtr.MustParseThreshold("error_rate < 1%"),
+		spidomtr.MustParseThreshold("p99 < 1s").ForTest("create-item"),
+	}, cfg.Thresholds)
+
+	tests := p.TestUnits()
+	require.Len(t, tests, 2)
+	require.Equal(t, "GET {{.Vars.host}}/items", tests[1].ID())
+
+	res := runner.Run(context.Background(), tests...)
+	require.Equal(t, 12, res.Stats.Passed, res.Stats.Errorm)
+	require.Empty(t, res.Check(cfg.Thresholds...))
+	require.Len(t, bodies, 6)
+	require.Contains(t, bodies, `{"name": "item-1-2"}`)
+}
+
+func strconvQuote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func TestParseJSON(t *testing.T) {
+	p, err := plan.Parse([]byte("{\n\t\"users\": 5,\n\t\"duration\": \"1m\",\n\t\"rate\": 10,\n\t\"tests\": [\n\t\t{\"url\": \"http://localhost\"}\n\t]\n}\n"))
+	require.NoError(t, err)
+	require.Equal(t, 5, p.Users)
+	require.Equal(t, time.Minute, p.Duration)
+	require.Equal(t, float64(10), p.Rate)
+	require.Equal(t, "http://localhost", p.Tests[0].URL)
+}
+
+func TestValidation(t *testing.T) {
+	for _, tc := range []struct {
+		plan   string
+		errors []string
+	}{
+		{
+			plan:   "",
+			errors: []string{"empty plan"},
+		},
+		{
+			plan:   "users: [\n",
+			errors: []string{"line 1: did not find expected node content"},
+		},
+		{
+			plan: `
+users: 10
+iterations: many
+timeout: soon
+tests:
+  - url: http://localhost
+    methd: GET
+`,
+			errors: []string{
+				"line 3: cannot unmarshal !!str `many` into int",
+				"line 4: cannot unmarshal !!str `soon` into time.Duration",
+				"line 7: field methd not found in type plan.Test",
+			},
+		},
+		{
+			plan: `
+users: -1
+percentiles: [50, 101]
+thresholds:
+  - p99 < 1s
+  - latency < 1s
+tests:
+  - id: a
+    method: get
+    url: http://localhost/{{.User
+    headers:
+      X-Test: "{{end}}"
+    expect:
+      status: [200, 999]
+      body_matches: "("
+  - id: a
+    url: http://localhost
+    thresholds:
+      - p99 < fast
+  - type: grpc
+  - method: POST
+`,
+			errors: []string{
+				"line 2: users must not be negative",
+				"line 3: percentile 101 out of range 1-100",
+				`line 6: invalid threshold "latency < 1s": unknown metric latency`,
+				`line 9: invalid method "get"`,
+				"line 10: invalid template: unclosed action",
+				"line 12: invalid template: unexpected {{end}}",
+				"line 14: invalid status 999",
+				"line 15: invalid pattern: error parsing regexp: missing closing ): `(`",
+				`line 16: duplicate test id "a", also used by test 1`,
+				`line 19: invalid threshold "p99 < fast": time: invalid duration "fast"`,
+				`line 20: unknown test type "grpc"`,
+				"line 21: url missing",
+			},
+		},
+		{
+			plan:   "users: 1\n",
+			errors: []string{"line 1: no tests"},
+		},
+	} {
+		_, err := plan.Parse([]byte(tc.plan))
+		var errs plan.Errors
+		require.ErrorAs(t, err, &errs, tc.plan)
+		msgs := make([]string, len(errs))
+		for i, e := range errs {
+			msgs[i] = e.Error()
+		}
+		require.Equal(t, tc.errors, msgs)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "plan.yaml")
+	require.NoError(t, os.WriteFile(name, []byte("tests:\n  - method: get\n    url: http://localhost\n"), 0o644))
+
+	_, err := plan.Load(name)
+	require.EqualError(t, err, name+`:2: invalid method "get"`)
+
+	_, err = plan.Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "no such file"))
+}
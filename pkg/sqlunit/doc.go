@@ -0,0 +1,3 @@
+// Package sqlunit builds spidomtr test units from database/sql queries
+// and statements
+package sqlunit
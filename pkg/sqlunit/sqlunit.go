@@ -0,0 +1,180 @@
+package sqlunit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+)
+
+// Counters, gauges and timings reported for each iteration
+const (
+	// RowsCounter counts rows returned by queries
+	RowsCounter = "sql.rows"
+	// RowsAffectedCounter counts rows affected by statements
+	RowsAffectedCounter = "sql.rows_affected"
+	// ConnWaitTiming is the time spent on getting a connection from
+	// the pool, including waiting for a free one or opening a new one
+	ConnWaitTiming = "sql.conn_wait"
+	// PoolWaitsGauge is the number of connections waited for since the
+	// test unit was constructed, according to sql.DBStats
+	PoolWaitsGauge = "sql.pool.waits"
+	// PoolWaitDurationGauge is the total time in seconds spent waiting
+	// for connections since the test unit was constructed, according
+	// to sql.DBStats
+	PoolWaitDurationGauge = "sql.pool.wait_duration"
+)
+
+// Mode type
+type Mode int
+
+const (
+	// QueryMode runs the query and reads all returned rows
+	QueryMode Mode = 0
+	// ExecMode executes the statement
+	ExecMode Mode = 1
+)
+
+// ArgsFunc returns the query args of an iteration
+type ArgsFunc func(ctx context.Context) ([]interface{}, error)
+
+// Config type
+type Config struct {
+	Args    ArgsFunc
+	Enabled func() (bool, string)
+	ID      string
+	Mode    Mode
+	Tx      bool
+	TxOpts  *sql.TxOptions
+}
+
+// Option type
+type Option func(*Config)
+
+// Args sets the func generating the query args of each iteration
+func Args(f ArgsFunc) Option {
+	return func(cfg *Config) {
+		cfg.Args = f
+	}
+}
+
+// Enabled adds enabled func
+func Enabled(f func() (bool, string)) Option {
+	return func(cfg *Config) {
+		cfg.Enabled = f
+	}
+}
+
+// Exec executes the statement instead of running it as a query
+func Exec() Option {
+	return func(cfg *Config) {
+		cfg.Mode = ExecMode
+	}
+}
+
+// ID sets the test unit id (defaults to the query)
+func ID(id string) Option {
+	return func(cfg *Config) {
+		cfg.ID = id
+	}
+}
+
+// Tx runs the query in a transaction, which is committed if the query
+// succeeds and rolled back otherwise
+func Tx(opts *sql.TxOptions) Option {
+	return func(cfg *Config) {
+		cfg.Tx = true
+		cfg.TxOpts = opts
+	}
+}
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// New constructs a test unit running query on db. Returned or affected
+// rows are counted in the test result, along with the time spent on
+// getting a connection from the pool. The pool waits of db are reported
+// as gauges, whose last values are the waits of the whole run.
+func New(db *sql.DB, query string, options ...Option) *testunit.TestAssembly {
+	cfg := &Config{
+		Args:    func(context.Context) ([]interface{}, error) { return nil, nil },
+		Enabled: func() (bool, string) { return true, "" },
+		ID:      query,
+	}
+
+	for _, opt := range options {
+		opt(cfg)
+	}
+
+	base := db.Stats()
+	return testunit.New(
+		testunit.ID(cfg.ID),
+		testunit.Enabled(cfg.Enabled),
+		testunit.Test(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			return args, run(ctx, db, base, query, cfg)
+		}),
+	)
+}
+
+func run(ctx context.Context, db *sql.DB, base sql.DBStats, query string, cfg *Config) (err error) {
+	args, err := cfg.Args(ctx)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	testunit.Timing(ctx, ConnWaitTiming, time.Since(start))
+	stats := db.Stats()
+	testunit.Gauge(ctx, PoolWaitsGauge, float64(stats.WaitCount-base.WaitCount))
+	testunit.Gauge(ctx, PoolWaitDurationGauge, (stats.WaitDuration - base.WaitDuration).Seconds())
+
+	var q querier = conn
+	if cfg.Tx {
+		var tx *sql.Tx
+		tx, err = conn.BeginTx(ctx, cfg.TxOpts)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				tx.Rollback()
+				return
+			}
+			err = tx.Commit()
+		}()
+		q = tx
+	}
+
+	if cfg.Mode == ExecMode {
+		res, err := q.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err == nil {
+			testunit.Count(ctx, RowsAffectedCounter, n)
+		}
+		return nil
+	}
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var n int64
+	for rows.Next() {
+		n++
+	}
+	testunit.Count(ctx, RowsCounter, n)
+	return rows.Err()
+}
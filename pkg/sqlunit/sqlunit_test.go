@@ -0,0 +1,180 @@
+package sqlunit_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/sqlunit"
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDriver is a database/sql driver where queries return as many rows
+// as their first arg, and statements affect as many rows as their
+// first arg. Queries containing "fail" return an error.
+type fakeDriver struct {
+	mu        sync.Mutex
+	commits   int
+	rollbacks int
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) {
+	return &fakeConn{d: d}, nil
+}
+
+type fakeConnector struct {
+	d *fakeDriver
+}
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.d.Open("")
+}
+
+func (c fakeConnector) Driver() driver.Driver {
+	return c.d
+}
+
+type fakeConn struct {
+	d *fakeDriver
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return &fakeTx{d: c.d}, nil
+}
+
+type fakeTx struct {
+	d *fakeDriver
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.d.mu.Lock()
+	defer tx.d.mu.Unlock()
+	tx.d.commits++
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.d.mu.Lock()
+	defer tx.d.mu.Unlock()
+	tx.d.rollbacks++
+	return nil
+}
+
+type fakeStmt struct {
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if strings.Contains(s.query, "fail") {
+		return nil, errors.New("statement failed")
+	}
+	return driver.RowsAffected(args[0].(int64)), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if strings.Contains(s.query, "fail") {
+		return nil, errors.New("query failed")
+	}
+	time.Sleep(time.Millisecond)
+	return &fakeRows{n: args[0].(int64)}, nil
+}
+
+type fakeRows struct {
+	n int64
+}
+
+func (r *fakeRows) Columns() []string { return []string{"id"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.n == 0 {
+		return io.EOF
+	}
+	dest[0] = r.n
+	r.n--
+	return nil
+}
+
+func args(a ...interface{}) sqlunit.ArgsFunc {
+	return func(context.Context) ([]interface{}, error) {
+		return a, nil
+	}
+}
+
+func TestSQLUnit(t *testing.T) {
+	fake := &fakeDriver{}
+	db := sql.OpenDB(fakeConnector{d: fake})
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	query := sqlunit.New(db, "SELECT id FROM items LIMIT ?",
+		sqlunit.ID("query"),
+		sqlunit.Args(func(ctx context.Context) ([]interface{}, error) {
+			return []interface{}{int64(testunit.Iteration(ctx) + 1)}, nil
+		}),
+	)
+	exec := sqlunit.New(db, "UPDATE items SET seen = true",
+		sqlunit.ID("exec"),
+		sqlunit.Args(args(int64(3))),
+		sqlunit.Exec(),
+		sqlunit.Tx(nil),
+	)
+	failing := sqlunit.New(db, "UPDATE fail",
+		sqlunit.ID("failing"),
+		sqlunit.Args(args(int64(1))),
+		sqlunit.Exec(),
+		sqlunit.Tx(nil),
+	)
+
+	runner := spidomtr.NewRunner(
+		spidomtr.Iterations(4),
+		spidomtr.ShowLogo(false),
+		spidomtr.ShowSummary(false),
+		spidomtr.Users(4),
+	)
+	res := runner.Run(context.Background(), query, exec, failing)
+
+	// Each user returns 1+2+3+4 rows
+	queryStats := res.TestStats["query"].Stats
+	require.Equal(t, 16, queryStats.Passed, queryStats.Errorm)
+	require.Equal(t, int64(4*10), queryStats.Counters[sqlunit.RowsCounter])
+	require.Equal(t, 16, queryStats.Phases[sqlunit.ConnWaitTiming].Count)
+
+	execStats := res.TestStats["exec"].Stats
+	require.Equal(t, 16, execStats.Passed, execStats.Errorm)
+	require.Equal(t, int64(16*3), execStats.Counters[sqlunit.RowsAffectedCounter])
+
+	require.Equal(t, map[string]int{"statement failed": 16}, res.TestStats["failing"].Stats.Errorm)
+
+	// Four users wait for a single connection
+	require.Equal(t, 32, res.Stats.Phases[sqlunit.ConnWaitTiming].Count)
+	require.Greater(t, res.Stats.Phases[sqlunit.ConnWaitTiming].Slowest, time.Duration(0))
+	waits := res.Stats.Metrics[sqlunit.PoolWaitsGauge]
+	require.Equal(t, spidomtr.GaugeKind, waits.Kind)
+	require.Equal(t, 48, waits.Count)
+	require.Greater(t, waits.Last, float64(0))
+	require.LessOrEqual(t, waits.Last, float64(db.Stats().WaitCount))
+	require.Greater(t, res.Stats.Metrics[sqlunit.PoolWaitDurationGauge].Last, float64(0))
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	require.Equal(t, 16, fake.commits)
+	require.Equal(t, 16, fake.rollbacks)
+}
@@ -0,0 +1,57 @@
+package store
+
+import (
+	"sync"
+
+	"github.com/spider-pigs/spidomtr"
+)
+
+// Handler is a runner handler saving the result of each run in a store
+type Handler struct {
+	cfg   spidomtr.Config
+	err   error
+	last  Metadata
+	mu    sync.Mutex
+	store *Store
+}
+
+// Handler returns a runner handler saving the result of each run, with
+// the runner config and the metadata of the host
+func (s *Store) Handler() *Handler {
+	return &Handler{store: s}
+}
+
+// RunnerConfig is called with the runner config before RunnerStarted.
+func (h *Handler) RunnerConfig(cfg spidomtr.Config) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.cfg = cfg
+}
+
+// RunnerStarted is called when runner is started (prior to any tests
+// have been run).
+func (h *Handler) RunnerStarted(id, description string, count int) {}
+
+// TestDone is called when a test has been completed.
+func (h *Handler) TestDone(res spidomtr.TestResult) {}
+
+// RunnerDone is called when the runner has run all tests.
+func (h *Handler) RunnerDone(res spidomtr.Result) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.last, h.err = h.store.Save(res, NewMetadata(h.cfg))
+}
+
+// Err returns the error of saving the last run, if any
+func (h *Handler) Err() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.err
+}
+
+// Last returns the metadata of the last saved run
+func (h *Handler) Last() Metadata {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.last
+}
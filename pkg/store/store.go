@@ -0,0 +1,283 @@
+// Package store persists spidomtr results with metadata in a local
+// directory, one JSON file per run grouped by runner ID, to keep a run
+// history without an external database
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+)
+
+// DefaultRunnerID is the runner ID of runs whose runner has no ID
+const DefaultRunnerID = "default"
+
+// ErrNotFound is returned when loading a run that does not exist
+var ErrNotFound = errors.New("store: run not found")
+
+// Metadata describes a stored run
+type Metadata struct {
+	Config    spidomtr.Config
+	Date      time.Time
+	GitSHA    string
+	GoVersion string
+	Hostname  string
+	ID        string
+	RunnerID  string
+}
+
+// Run is a stored result with its metadata
+type Run struct {
+	Metadata Metadata
+	Result   spidomtr.Result
+}
+
+// Store is a directory based run store
+type Store struct {
+	dir string
+}
+
+// Open opens the store in dir, which is created if it does not exist
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("store: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// NewMetadata constructs metadata of a run of a runner with cfg on this
+// host. The git SHA is read from the build info of the binary, or from
+// git in the working directory.
+func NewMetadata(cfg spidomtr.Config) Metadata {
+	hostname, _ := os.Hostname()
+	runnerID := cfg.ID
+	if runnerID == "" {
+		runnerID = DefaultRunnerID
+	}
+	return Metadata{
+		Config:    cfg,
+		Date:      time.Now(),
+		GitSHA:    gitSHA(),
+		GoVersion: runtime.Version(),
+		Hostname:  hostname,
+		RunnerID:  runnerID,
+	}
+}
+
+// Save stores res with meta, and returns the metadata of the stored
+// run. The run ID is generated from the date of the run.
+func (s *Store) Save(res spidomtr.Result, meta Metadata) (Metadata, error) {
+	if meta.RunnerID == "" {
+		meta.RunnerID = DefaultRunnerID
+	}
+	if meta.Date.IsZero() {
+		meta.Date = time.Now()
+	}
+	meta.ID = newRunID(meta.Date)
+
+	dir := s.runnerDir(meta.RunnerID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return meta, fmt.Errorf("store: %w", err)
+	}
+
+	b, err := json.Marshal(Run{Metadata: meta, Result: res})
+	if err != nil {
+		return meta, fmt.Errorf("store: %w", err)
+	}
+
+	// Write to a temporary file first, so a run is never partially stored
+	tmp, err := os.CreateTemp(dir, ".run-*")
+	if err != nil {
+		return meta, fmt.Errorf("store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return meta, fmt.Errorf("store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return meta, fmt.Errorf("store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, meta.ID+".json")); err != nil {
+		return meta, fmt.Errorf("store: %w", err)
+	}
+	return meta, nil
+}
+
+// RunnerIDs returns the IDs of the runners with stored runs, sorted
+func (s *Store) RunnerIDs() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("store: %w", err)
+	}
+	var ids []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		id := unescape(e.Name())
+		names, err := s.runNames(id)
+		if err != nil {
+			return nil, err
+		}
+		if len(names) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// List returns the metadata of the stored runs of a runner, oldest
+// first
+func (s *Store) List(runnerID string) ([]Metadata, error) {
+	names, err := s.runNames(runnerID)
+	if err != nil {
+		return nil, err
+	}
+	metas := make([]Metadata, 0, len(names))
+	for _, name := range names {
+		var run struct{ Metadata Metadata }
+		if err := readJSON(filepath.Join(s.runnerDir(runnerID), name), &run); err != nil {
+			return nil, err
+		}
+		metas = append(metas, run.Metadata)
+	}
+	return metas, nil
+}
+
+// Load loads a stored run of a runner
+func (s *Store) Load(runnerID, id string) (Run, error) {
+	var run Run
+	err := readJSON(filepath.Join(s.runnerDir(runnerID), filepath.Base(id)+".json"), &run)
+	return run, err
+}
+
+// Last loads the last n stored runs of a runner, oldest first
+func (s *Store) Last(runnerID string, n int) ([]Run, error) {
+	names, err := s.runNames(runnerID)
+	if err != nil {
+		return nil, err
+	}
+	if n < len(names) {
+		names = names[len(names)-n:]
+	}
+	runs := make([]Run, len(names))
+	for i, name := range names {
+		if err := readJSON(filepath.Join(s.runnerDir(runnerID), name), &runs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return runs, nil
+}
+
+// runNames returns the file names of the stored runs of a runner,
+// oldest first
+func (s *Store) runNames(runnerID string) ([]string, error) {
+	entries, err := os.ReadDir(s.runnerDir(runnerID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("store: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") && !strings.HasPrefix(e.Name(), ".") {
+			names = append(names, e.Name())
+		}
+	}
+	// Run IDs start with the date, so they sort chronologically
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *Store) runnerDir(runnerID string) string {
+	if runnerID == "" {
+		runnerID = DefaultRunnerID
+	}
+	return filepath.Join(s.dir, escape(runnerID))
+}
+
+func readJSON(name string, v interface{}) error {
+	b, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	} else if err != nil {
+		return fmt.Errorf("store: %w", err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("store: %s: %w", filepath.Base(name), err)
+	}
+	return nil
+}
+
+// escape makes a runner ID safe to use as a directory name
+func escape(id string) string {
+	var sb strings.Builder
+	for _, c := range []byte(id) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.' && sb.Len() > 0:
+			sb.WriteByte(c)
+		default:
+			fmt.Fprintf(&sb, "%%%02x", c)
+		}
+	}
+	return sb.String()
+}
+
+func unescape(name string) string {
+	var sb strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '%' && i+2 < len(name) {
+			if b, err := hex.DecodeString(name[i+1 : i+3]); err == nil {
+				sb.Write(b)
+				i += 2
+				continue
+			}
+		}
+		sb.WriteByte(name[i])
+	}
+	return sb.String()
+}
+
+func newRunID(date time.Time) string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return date.UTC().Format("20060102T150405.000000000Z") + "-" + hex.EncodeToString(b)
+}
+
+var (
+	gitSHAOnce  sync.Once
+	gitSHAValue string
+)
+
+func gitSHA() string {
+	gitSHAOnce.Do(func() {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			for _, s := range info.Settings {
+				if s.Key == "vcs.revision" {
+					gitSHAValue = s.Value
+					return
+				}
+			}
+		}
+		out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+		if err == nil {
+			gitSHAValue = strings.TrimSpace(string(out))
+		}
+	})
+	return gitSHAValue
+}
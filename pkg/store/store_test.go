@@ -0,0 +1,105 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/store"
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	s, err := store.Open(t.TempDir())
+	require.NoError(t, err)
+	h := s.Handler()
+
+	runner := spidomtr.NewRunner(
+		spidomtr.ID("api/v1 tests"),
+		spidomtr.Handlers(h),
+		spidomtr.Iterations(3),
+		spidomtr.ShowLogo(false),
+		spidomtr.ShowSummary(false),
+		spidomtr.Thresholds(spidomtr.MustParseThreshold("p99 < 1s")),
+		spidomtr.Users(2),
+	)
+	test := testunit.New(
+		testunit.ID("fail"),
+		testunit.Test(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			return args, errors.New("whooops")
+		}),
+	)
+	res := runner.Run(context.Background(), test)
+	require.NoError(t, h.Err())
+
+	ids, err := s.RunnerIDs()
+	require.NoError(t, err)
+	require.Equal(t, []string{"api/v1 tests"}, ids)
+
+	run, err := s.Load("api/v1 tests", h.Last().ID)
+	require.NoError(t, err)
+	require.Equal(t, h.Last().ID, run.Metadata.ID)
+	require.Equal(t, "api/v1 tests", run.Metadata.RunnerID)
+	require.Equal(t, runtime.Version(), run.Metadata.GoVersion)
+	require.NotEmpty(t, run.Metadata.Hostname)
+	require.Equal(t, 2, run.Metadata.Config.Users)
+	require.Equal(t, []spidomtr.Threshold{spidomtr.MustParseThreshold("p99 < 1s")}, run.Metadata.Config.Thresholds)
+
+	require.Equal(t, res.Stats.Count, run.Result.Stats.Count)
+	require.Equal(t, res.Stats.Errorm, run.Result.Stats.Errorm)
+	require.Len(t, res.ChildResults, 2)
+	require.Nil(t, run.Result.ChildResults)
+	results := run.Result.TestStats["fail"].TestResults
+	require.Len(t, results, 6)
+	require.EqualError(t, results[0].Error, "whooops")
+	require.Equal(t, testunit.Fail, results[0].Outcome)
+}
+
+func TestHistory(t *testing.T) {
+	s, err := store.Open(t.TempDir())
+	require.NoError(t, err)
+
+	date := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var ids []string
+	for i := 0; i < 5; i++ {
+		res := spidomtr.Result{Stats: spidomtr.Stats{Count: i}}
+		meta, err := s.Save(res, store.Metadata{Date: date.Add(time.Duration(4-i) * -time.Hour)})
+		require.NoError(t, err)
+		require.Equal(t, store.DefaultRunnerID, meta.RunnerID)
+		ids = append(ids, meta.ID)
+	}
+	_, err = s.Save(spidomtr.Result{}, store.Metadata{RunnerID: "other", Date: date})
+	require.NoError(t, err)
+
+	ids2, err := s.RunnerIDs()
+	require.NoError(t, err)
+	require.Equal(t, []string{store.DefaultRunnerID, "other"}, ids2)
+
+	metas, err := s.List("")
+	require.NoError(t, err)
+	require.Len(t, metas, 5)
+	for i, meta := range metas {
+		require.Equal(t, ids[i], meta.ID)
+	}
+
+	runs, err := s.Last(store.DefaultRunnerID, 2)
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	require.Equal(t, 3, runs[0].Result.Stats.Count)
+	require.Equal(t, 4, runs[1].Result.Stats.Count)
+
+	runs, err = s.Last(store.DefaultRunnerID, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 5)
+
+	metas, err = s.List("missing")
+	require.NoError(t, err)
+	require.Empty(t, metas)
+
+	_, err = s.Load(store.DefaultRunnerID, "missing")
+	require.ErrorIs(t, err, store.ErrNotFound)
+}
@@ -0,0 +1,33 @@
+package testunit
+
+import "context"
+
+type userKey struct{}
+
+type iterationKey struct{}
+
+// WithUser returns a copy of ctx carrying the index of the simulated
+// user running the test
+func WithUser(ctx context.Context, user int) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// User returns the index of the simulated user running the test ctx
+// belongs to (defaults to 0)
+func User(ctx context.Context) int {
+	user, _ := ctx.Value(userKey{}).(int)
+	return user
+}
+
+// WithIteration returns a copy of ctx carrying the iteration of the
+// test run
+func WithIteration(ctx context.Context, iteration int) context.Context {
+	return context.WithValue(ctx, iterationKey{}, iteration)
+}
+
+// Iteration returns the iteration of the test run ctx belongs to
+// (defaults to 0)
+func Iteration(ctx context.Context) int {
+	iteration, _ := ctx.Value(iterationKey{}).(int)
+	return iteration
+}
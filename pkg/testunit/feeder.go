@@ -0,0 +1,57 @@
+package testunit
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrExhausted is returned by a feeder that has no more records.
+// Iterations of a test whose feeder is exhausted are skipped.
+var ErrExhausted = errors.New("feeder exhausted")
+
+// Feeder feeds a test with a data record per iteration
+type Feeder interface {
+	// Next returns the record for the test run ctx belongs to, which
+	// carries the user and iteration of the run.
+	Next(ctx context.Context) (interface{}, error)
+}
+
+// FedTestUnit is implemented by test units that are fed a data record
+// per iteration
+type FedTestUnit interface {
+	TestUnit
+	// Feeder returns the feeder, or nil if the test has none
+	Feeder() Feeder
+}
+
+// Feed sets a feeder. The record for an iteration is fetched before
+// Prepare is run, and is available to Prepare, Test and Cleanup with
+// Record(ctx).
+func Feed(f Feeder) Option {
+	return func(cfg *Config) {
+		cfg.Feeder = f
+	}
+}
+
+// Record returns the feeder record of the test run ctx belongs to, or
+// nil if the test has no feeder
+func Record(ctx context.Context) interface{} {
+	if rec := RecorderFromContext(ctx); rec != nil {
+		return rec.Record()
+	}
+	return nil
+}
+
+// SetRecord sets the feeder record of the test run
+func (rec *Recorder) SetRecord(record interface{}) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.record = record
+}
+
+// Record returns the feeder record of the test run
+func (rec *Recorder) Record() interface{} {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.record
+}
@@ -0,0 +1,177 @@
+package testunit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type recorderKey struct{}
+
+// Recorder collects values reported by a test during a single run
+type Recorder struct {
+	mu       sync.Mutex
+	attempts int
+	counters map[string]int64
+	gauges   map[string]float64
+	record   interface{}
+	tags     map[string]string
+	timings  map[string]time.Duration
+	trends   map[string][]time.Duration
+	values   map[string][]float64
+}
+
+// NewRecorder constructs a new recorder
+func NewRecorder() *Recorder {
+	return &Recorder{
+		counters: make(map[string]int64),
+		gauges:   make(map[string]float64),
+		tags:     make(map[string]string),
+		timings:  make(map[string]time.Duration),
+		trends:   make(map[string][]time.Duration),
+		values:   make(map[string][]float64),
+	}
+}
+
+// WithRecorder returns a copy of ctx carrying rec
+func WithRecorder(ctx context.Context, rec *Recorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, rec)
+}
+
+// RecorderFromContext returns the recorder carried by ctx, or nil
+func RecorderFromContext(ctx context.Context) *Recorder {
+	rec, _ := ctx.Value(recorderKey{}).(*Recorder)
+	return rec
+}
+
+// Gauge sets the named gauge of the test run ctx belongs to to v. It
+// does nothing if ctx does not belong to a test run.
+func Gauge(ctx context.Context, name string, v float64) {
+	if rec := RecorderFromContext(ctx); rec != nil {
+		rec.SetGauge(name, v)
+	}
+}
+
+// Count adds n to the named counter of the test run ctx belongs to. It
+// does nothing if ctx does not belong to a test run.
+func Count(ctx context.Context, name string, n int64) {
+	if rec := RecorderFromContext(ctx); rec != nil {
+		rec.Count(name, n)
+	}
+}
+
+// Timing adds d to the named sub-timing of the test run ctx belongs
+// to, e.g. the time spent on a DNS lookup. It does nothing if ctx does
+// not belong to a test run.
+func Timing(ctx context.Context, name string, d time.Duration) {
+	if rec := RecorderFromContext(ctx); rec != nil {
+		rec.Timing(name, d)
+	}
+}
+
+// Count adds n to the named counter
+func (rec *Recorder) Count(name string, n int64) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.counters[name] += n
+}
+
+// Counters returns a copy of the counters, or nil if there are none
+func (rec *Recorder) Counters() map[string]int64 {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.counters) == 0 {
+		return nil
+	}
+	m := make(map[string]int64, len(rec.counters))
+	for k, v := range rec.counters {
+		m[k] = v
+	}
+	return m
+}
+
+// Timing adds d to the named sub-timing
+func (rec *Recorder) Timing(name string, d time.Duration) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.timings[name] += d
+}
+
+// Timings returns a copy of the sub-timings, or nil if there are none
+func (rec *Recorder) Timings() map[string]time.Duration {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.timings) == 0 {
+		return nil
+	}
+	m := make(map[string]time.Duration, len(rec.timings))
+	for k, v := range rec.timings {
+		m[k] = v
+	}
+	return m
+}
+
+// SetGauge sets the named gauge to v, keeping the last value set
+func (rec *Recorder) SetGauge(name string, v float64) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.gauges[name] = v
+}
+
+// Gauges returns a copy of the gauges, or nil if there are none
+func (rec *Recorder) Gauges() map[string]float64 {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.gauges) == 0 {
+		return nil
+	}
+	m := make(map[string]float64, len(rec.gauges))
+	for k, v := range rec.gauges {
+		m[k] = v
+	}
+	return m
+}
+
+// Observe adds v to the values of the named histogram
+func (rec *Recorder) Observe(name string, v float64) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.values[name] = append(rec.values[name], v)
+}
+
+// Values returns a copy of the histogram values, or nil if there are
+// none
+func (rec *Recorder) Values() map[string][]float64 {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.values) == 0 {
+		return nil
+	}
+	m := make(map[string][]float64, len(rec.values))
+	for k, v := range rec.values {
+		m[k] = append([]float64(nil), v...)
+	}
+	return m
+}
+
+// Trend adds d to the durations of the named trend
+func (rec *Recorder) Trend(name string, d time.Duration) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.trends[name] = append(rec.trends[name], d)
+}
+
+// Trends returns a copy of the trend durations, or nil if there are
+// none
+func (rec *Recorder) Trends() map[string][]time.Duration {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.trends) == 0 {
+		return nil
+	}
+	m := make(map[string][]time.Duration, len(rec.trends))
+	for k, v := range rec.trends {
+		m[k] = append([]time.Duration(nil), v...)
+	}
+	return m
+}
@@ -0,0 +1,148 @@
+package testunit
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy decides how a failing Test func is retried
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the
+	// first one
+	MaxAttempts int
+	// Backoff is the delay before the first retry (defaults to 100ms)
+	Backoff time.Duration
+	// MaxBackoff caps the delay between retries (no cap if 0)
+	MaxBackoff time.Duration
+	// Multiplier multiplies the delay after each retry (defaults to 2)
+	Multiplier float64
+	// Jitter randomizes each delay by up to this fraction of it, e.g.
+	// 0.2 for ±20%
+	Jitter float64
+	// Retryable reports if err should be retried (defaults to all
+	// errors)
+	Retryable func(err error) bool
+}
+
+// Retry sets a retry policy for the Test func. The number of attempts
+// is recorded in the test result, and the test duration includes all
+// attempts and the delays between them. The counters, timings and other
+// values reported by the Test func are those of the last attempt.
+func Retry(policy RetryPolicy) Option {
+	return func(cfg *Config) {
+		cfg.Retry = &policy
+	}
+}
+
+// delay returns the delay before retry n, starting at 1
+func (p RetryPolicy) delay(n int) time.Duration {
+	d := float64(p.Backoff)
+	if d <= 0 {
+		d = float64(100 * time.Millisecond)
+	}
+	mult := p.Multiplier
+	if mult <= 0 {
+		mult = 2
+	}
+	for i := 1; i < n && (p.MaxBackoff <= 0 || d < float64(p.MaxBackoff)); i++ {
+		d *= mult
+	}
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// retry runs f until it succeeds, the attempts run out, the error is
+// not retryable or ctx is done. The number of attempts is recorded in
+// the recorder of ctx, and the values reported by a retried attempt are
+// discarded.
+func (p RetryPolicy) retry(ctx context.Context, args []interface{}, f func(context.Context, []interface{}) ([]interface{}, error)) ([]interface{}, error) {
+	rec := RecorderFromContext(ctx)
+	var initial *Recorder
+	if rec != nil {
+		initial = rec.snapshot()
+	}
+	for attempt := 1; ; attempt++ {
+		if rec != nil {
+			rec.restore(initial)
+			rec.SetAttempts(attempt)
+		}
+		res, err := f(ctx, args)
+		if err == nil || attempt >= p.MaxAttempts || (p.Retryable != nil && !p.Retryable(err)) {
+			return res, err
+		}
+
+		t := time.NewTimer(p.delay(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return res, err
+		case <-t.C:
+		}
+	}
+}
+
+// SetAttempts sets the number of attempts of the Test func
+func (rec *Recorder) SetAttempts(n int) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.attempts = n
+}
+
+// Attempts returns the number of attempts of the Test func, or 0 if the
+// test has no retry policy
+func (rec *Recorder) Attempts() int {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.attempts
+}
+
+// snapshot returns a copy of the values reported so far
+func (rec *Recorder) snapshot() *Recorder {
+	s := NewRecorder()
+	s.restore(rec)
+	return s
+}
+
+// restore replaces the reported values with those of s, keeping the
+// record and the number of attempts
+func (rec *Recorder) restore(s *Recorder) {
+	counters := s.Counters()
+	gauges := s.Gauges()
+	tags := s.Tags()
+	timings := s.Timings()
+	trends := s.Trends()
+	values := s.Values()
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.counters = make(map[string]int64, len(counters))
+	for k, v := range counters {
+		rec.counters[k] = v
+	}
+	rec.gauges = make(map[string]float64, len(gauges))
+	for k, v := range gauges {
+		rec.gauges[k] = v
+	}
+	rec.tags = make(map[string]string, len(tags))
+	for k, v := range tags {
+		rec.tags[k] = v
+	}
+	rec.timings = make(map[string]time.Duration, len(timings))
+	for k, v := range timings {
+		rec.timings[k] = v
+	}
+	rec.trends = make(map[string][]time.Duration, len(trends))
+	for k, v := range trends {
+		rec.trends[k] = v
+	}
+	rec.values = make(map[string][]float64, len(values))
+	for k, v := range values {
+		rec.values[k] = v
+	}
+}
@@ -0,0 +1,118 @@
+package testunit_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+	"github.com/stretchr/testify/require"
+)
+
+var errTransient = errors.New("transient")
+
+func TestRetry(t *testing.T) {
+	var mu sync.Mutex
+	calls := make(map[int]int)
+	test := testunit.New(
+		testunit.ID("flaky"),
+		testunit.Retry(testunit.RetryPolicy{
+			MaxAttempts: 3,
+			Backoff:     time.Millisecond,
+			Jitter:      0.5,
+			Retryable: func(err error) bool {
+				return errors.Is(err, errTransient)
+			},
+		}),
+		testunit.Test(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			i := testunit.Iteration(ctx)
+			calls[i]++
+			switch {
+			case i == 1 && calls[i] < 2:
+				// Succeeds on the second attempt
+				return args, errTransient
+			case i == 2:
+				// Never succeeds
+				return args, errTransient
+			case i == 3:
+				// Not retryable
+				return args, errors.New("permanent")
+			}
+			return args, nil
+		}),
+	)
+
+	runner := spidomtr.NewRunner(
+		spidomtr.Iterations(4),
+		spidomtr.ShowLogo(false),
+		spidomtr.ShowSummary(false),
+	)
+	res := runner.Run(context.Background(), test)
+
+	var attempts []int
+	for _, tr := range res.TestStats["flaky"].TestResults {
+		attempts = append(attempts, tr.Attempts)
+	}
+	require.Equal(t, []int{1, 2, 3, 1}, attempts)
+	require.Equal(t, 2, res.Stats.Passed)
+	require.Equal(t, 1, res.Stats.PassedRetried)
+	require.Equal(t, 3, res.Stats.Retries)
+	require.Equal(t, 2, res.Stats.Errors)
+	require.Equal(t, res.Stats.PassedRetried, res.TestStats["flaky"].Stats.PassedRetried)
+	require.Equal(t, res.Stats.Retries, res.TestStats["flaky"].Stats.Retries)
+}
+
+func TestRetryContextDone(t *testing.T) {
+	var calls int
+	test := testunit.New(
+		testunit.Retry(testunit.RetryPolicy{MaxAttempts: 5, Backoff: time.Hour}),
+		testunit.Test(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			calls++
+			return args, errTransient
+		}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := test.Test(ctx, nil)
+	require.ErrorIs(t, err, errTransient)
+	require.Equal(t, 1, calls)
+}
+
+func TestRetryLastAttempt(t *testing.T) {
+	var calls int
+	test := testunit.New(
+		testunit.ID("retried"),
+		testunit.Retry(testunit.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}),
+		testunit.Test(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			calls++
+			testunit.Count(ctx, "calls", 1)
+			testunit.Timing(ctx, "phase", time.Duration(calls)*time.Millisecond)
+			if calls < 3 {
+				testunit.Tag(ctx, "status", "503")
+				return args, errTransient
+			}
+			testunit.Tag(ctx, "status", "200")
+			return args, nil
+		}),
+	)
+
+	runner := spidomtr.NewRunner(
+		spidomtr.ShowLogo(false),
+		spidomtr.ShowSummary(false),
+	)
+	res := runner.Run(context.Background(), test)
+	require.Equal(t, 1, res.Stats.Passed)
+
+	// Only the values reported by the last attempt are recorded
+	tr := res.TestStats["retried"].TestResults[0]
+	require.Equal(t, 3, tr.Attempts)
+	require.Equal(t, map[string]int64{"calls": 1}, tr.Counters)
+	require.Equal(t, map[string]time.Duration{"phase": 3 * time.Millisecond}, tr.Timings)
+	require.Equal(t, "200", tr.Tags["status"])
+}
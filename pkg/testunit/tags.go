@@ -0,0 +1,58 @@
+package testunit
+
+import "context"
+
+// TaggedTestUnit is implemented by test units with tags
+type TaggedTestUnit interface {
+	TestUnit
+	// Tags returns the tags, or nil if the test has none
+	Tags() map[string]string
+}
+
+// Tags adds tags, e.g. {"endpoint": "items", "region": "eu"}, to the
+// results of the test
+func Tags(tags map[string]string) Option {
+	return func(cfg *Config) {
+		if cfg.Tags == nil {
+			cfg.Tags = make(map[string]string, len(tags))
+		}
+		for k, v := range tags {
+			cfg.Tags[k] = v
+		}
+	}
+}
+
+// Tag tags the result of the test run ctx belongs to, e.g. with a
+// status code, overriding a tag of the test with the same key. It does
+// nothing if ctx does not belong to a test run.
+func Tag(ctx context.Context, key, value string) {
+	if rec := RecorderFromContext(ctx); rec != nil {
+		rec.SetTag(key, value)
+	}
+}
+
+// SetTag sets the tag key to value
+func (rec *Recorder) SetTag(key, value string) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.tags[key] = value
+}
+
+// Tags returns a copy of the tags set during the test run, or nil if
+// there are none
+func (rec *Recorder) Tags() map[string]string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return copyTags(rec.tags)
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(tags))
+	for k, v := range tags {
+		m[k] = v
+	}
+	return m
+}
@@ -2,6 +2,7 @@ package testunit
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -22,11 +23,15 @@ type TestUnit interface {
 
 // Config type
 type Config struct {
-	Enabled func() (bool, string)
-	ID      string
-	Prepare func(context.Context) ([]interface{}, error)
-	Test    func(context.Context, []interface{}) ([]interface{}, error)
-	Cleanup func(context.Context, []interface{}) error
+	Enabled   func() (bool, string)
+	Feeder    Feeder
+	ID        string
+	Prepare   func(context.Context) ([]interface{}, error)
+	Retry     *RetryPolicy
+	Tags      map[string]string
+	Test      func(context.Context, []interface{}) ([]interface{}, error)
+	ThinkTime time.Duration
+	Cleanup   func(context.Context, []interface{}) error
 }
 
 // Option type
@@ -98,6 +103,16 @@ func (test *TestAssembly) Enabled() (bool, string) {
 	return test.cfg.Enabled()
 }
 
+// Feeder returns the feeder, or nil if the test has none
+func (test *TestAssembly) Feeder() Feeder {
+	return test.cfg.Feeder
+}
+
+// Tags returns a copy of the tags, or nil if the test has none
+func (test *TestAssembly) Tags() map[string]string {
+	return copyTags(test.cfg.Tags)
+}
+
 // Prepare runs prior to Test(context.Context, []interface{}) error
 func (test *TestAssembly) Prepare(ctx context.Context) ([]interface{}, error) {
 	return test.cfg.Prepare(ctx)
@@ -105,6 +120,9 @@ func (test *TestAssembly) Prepare(ctx context.Context) ([]interface{}, error) {
 
 // Test is the main test func
 func (test *TestAssembly) Test(ctx context.Context, args []interface{}) ([]interface{}, error) {
+	if test.cfg.Retry != nil {
+		return test.cfg.Retry.retry(ctx, args, test.cfg.Test)
+	}
 	return test.cfg.Test(ctx, args)
 }
 
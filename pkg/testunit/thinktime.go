@@ -0,0 +1,27 @@
+package testunit
+
+import "time"
+
+// PausedTestUnit is implemented by test units that pause before each
+// iteration
+type PausedTestUnit interface {
+	TestUnit
+	// ThinkTime returns the pause before each iteration, or 0 if the
+	// test has none
+	ThinkTime() time.Duration
+}
+
+// ThinkTime pauses d before each iteration of the test, e.g. to
+// simulate the time a user spends on a page. The pause is neither
+// timed nor counted against the test timeout.
+func ThinkTime(d time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.ThinkTime = d
+	}
+}
+
+// ThinkTime returns the pause before each iteration, or 0 if the test
+// has none
+func (test *TestAssembly) ThinkTime() time.Duration {
+	return test.cfg.ThinkTime
+}
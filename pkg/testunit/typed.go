@@ -0,0 +1,56 @@
+package testunit
+
+import "context"
+
+// Typed holds the funcs of a test passing state of type S between
+// them. Prepare returns the initial state, Test receives the state and
+// returns the state passed to Cleanup. Funcs left nil are skipped, and
+// the state then defaults to the zero value of S.
+type Typed[S any] struct {
+	Prepare func(context.Context) (S, error)
+	Test    func(context.Context, S) (S, error)
+	Cleanup func(context.Context, S) error
+}
+
+// NewTyped constructs a new test from typed funcs, adapted to the
+// TestUnit interface. Options such as ID and Enabled apply as for New,
+// but Prepare, Test and Cleanup options are overridden by the typed
+// funcs.
+func NewTyped[S any](typed Typed[S], options ...Option) *TestAssembly {
+	test := New(options...)
+
+	test.cfg.Prepare = func(ctx context.Context) ([]interface{}, error) {
+		var s S
+		if typed.Prepare != nil {
+			var err error
+			if s, err = typed.Prepare(ctx); err != nil {
+				return nil, err
+			}
+		}
+		return []interface{}{s}, nil
+	}
+	test.cfg.Test = func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+		s := state[S](args)
+		if typed.Test == nil {
+			return args, nil
+		}
+		s, err := typed.Test(ctx, s)
+		return []interface{}{s}, err
+	}
+	test.cfg.Cleanup = func(ctx context.Context, args []interface{}) error {
+		if typed.Cleanup == nil {
+			return nil
+		}
+		return typed.Cleanup(ctx, state[S](args))
+	}
+	return test
+}
+
+// state returns the state carried in args, or the zero value of S
+func state[S any](args []interface{}) S {
+	var s S
+	if len(args) > 0 {
+		s, _ = args[0].(S)
+	}
+	return s
+}
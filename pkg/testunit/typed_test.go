@@ -0,0 +1,81 @@
+package testunit_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+	"github.com/stretchr/testify/require"
+)
+
+type session struct {
+	token string
+	calls int
+}
+
+func TestNewTyped(t *testing.T) {
+	var cleaned []*session
+	test := testunit.NewTyped(
+		testunit.Typed[*session]{
+			Prepare: func(ctx context.Context) (*session, error) {
+				return &session{token: "secret"}, nil
+			},
+			Test: func(ctx context.Context, s *session) (*session, error) {
+				s.calls++
+				return s, nil
+			},
+			Cleanup: func(ctx context.Context, s *session) error {
+				cleaned = append(cleaned, s)
+				return nil
+			},
+		},
+		testunit.ID("typed"),
+	)
+	require.Equal(t, "typed", test.ID())
+
+	runner := spidomtr.NewRunner(
+		spidomtr.Iterations(5),
+		spidomtr.ShowLogo(false),
+		spidomtr.ShowSummary(false),
+	)
+	res := runner.Run(context.Background(), test)
+	require.Equal(t, 5, res.Stats.Passed)
+	require.Len(t, cleaned, 5)
+	for _, s := range cleaned {
+		require.Equal(t, &session{token: "secret", calls: 1}, s)
+	}
+}
+
+func TestNewTypedDefaults(t *testing.T) {
+	var got []int
+	test := testunit.NewTyped(testunit.Typed[int]{
+		Test: func(ctx context.Context, n int) (int, error) {
+			got = append(got, n)
+			return n + 1, nil
+		},
+		Cleanup: func(ctx context.Context, n int) error {
+			got = append(got, n)
+			return nil
+		},
+	})
+
+	args, err := test.Prepare(context.Background())
+	require.NoError(t, err)
+	args, err = test.Test(context.Background(), args)
+	require.NoError(t, err)
+	require.NoError(t, test.Cleanup(context.Background(), args))
+	require.Equal(t, []int{0, 1}, got)
+
+	failing := testunit.NewTyped(testunit.Typed[error]{
+		Prepare: func(ctx context.Context) (error, error) {
+			return nil, errors.New("whooops")
+		},
+	})
+	_, err = failing.Prepare(context.Background())
+	require.EqualError(t, err, "whooops")
+	args, err = failing.Test(context.Background(), []interface{}{nil})
+	require.NoError(t, err)
+	require.NoError(t, failing.Cleanup(context.Background(), args))
+}
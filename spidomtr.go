@@ -2,7 +2,10 @@ package spidomtr
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"sort"
 	"sync"
 	"time"
@@ -27,7 +30,10 @@ var DefaultPercentiles = []int{10, 25, 50, 75, 90, 95, 99}
 
 // Result type
 type Result struct {
-	ChildResults []Result
+	// ChildResults are the joined results, e.g. of each user. They are
+	// not saved with a result, since their test results are in the
+	// TestStats already.
+	ChildResults []Result `json:"-"`
 	Date         time.Time
 	Stats        Stats
 	TestStats    map[string]TestStats
@@ -35,20 +41,32 @@ type Result struct {
 
 // TestResult type
 type TestResult struct {
-	Comment  string
-	Date     time.Time
-	Duration time.Duration
-	End      time.Time
-	Error    error
-	ID       string
-	Outcome  testunit.TestOutcome
-	Start    time.Time
+	Attempts   int
+	Comment    string
+	Counters   map[string]int64
+	Date       time.Time
+	Duration   time.Duration
+	End        time.Time
+	Error      error
+	ErrorClass string
+	Gauges     map[string]float64
+	Histograms map[string][]float64
+	ID         string
+	Iteration  int
+	Outcome    testunit.TestOutcome
+	Record     interface{}
+	Start      time.Time
+	Tags       map[string]string
+	Timings    map[string]time.Duration
+	Trends     map[string][]time.Duration
+	User       int
 }
 
 // Stats type
 type Stats struct {
 	Average       time.Duration
 	Count         int
+	Counters      map[string]int64
 	Description   string
 	Distributions []LatencyDist
 	Duration      time.Duration
@@ -56,9 +74,14 @@ type Stats struct {
 	End           time.Time
 	Errorm        map[string]int
 	Errors        int
+	ErrorSamples  map[string][]string
 	Fastest       time.Duration
 	Histogram     []Bucket
+	Metrics       map[string]MetricStats
 	Passed        int
+	PassedRetried int
+	Phases        map[string]PhaseStats
+	Retries       int
 	RPS           float64
 	Skips         int
 	Slowest       time.Duration
@@ -74,14 +97,21 @@ type TestStats struct {
 // Config type
 type Config struct {
 	Description      string
+	Duration         time.Duration
+	ErrorClassifiers []ErrorClassifier `json:"-"`
 	ID               string
 	Iterations       int
-	Handlers         []RunnerHandler
+	Handlers         []RunnerHandler `json:"-"`
 	HistogramBuckets int
+	MaxErrorClasses  int
+	Output           io.Writer `json:"-"`
 	Percentiles      []int
+	Rate             float64
 	ShowLogo         bool
 	ShowSummary      bool
+	Thresholds       []Threshold
 	Timeout          time.Duration
+	TotalIterations  int
 	Users            int
 }
 
@@ -95,6 +125,24 @@ func Description(description string) Option {
 	}
 }
 
+// Duration makes users run the tests over and over until the duration
+// has passed, instead of a number of iterations
+func Duration(d time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.Duration = d
+	}
+}
+
+// ErrorClassifiers sets the classifiers errors are counted by in the
+// error distributions. The first classifier that applies to an error
+// decides its class, and errors no classifier applies to are classed by
+// their message.
+func ErrorClassifiers(c ...ErrorClassifier) Option {
+	return func(cfg *Config) {
+		cfg.ErrorClassifiers = c
+	}
+}
+
 // Handlers sets runner handlers
 func Handlers(h ...RunnerHandler) Option {
 	return func(cfg *Config) {
@@ -123,6 +171,33 @@ func Iterations(i int) Option {
 	}
 }
 
+// MaxErrorClasses caps the number of classes in the error
+// distributions of the result, counting the least frequent as
+// OtherErrors (defaults to 50, 0 is no cap). During the run, each user
+// counts new classes as OtherErrors once it has seen n classes; classify
+// errors with ErrorClassifiers to keep them few.
+func MaxErrorClasses(n int) Option {
+	return func(cfg *Config) {
+		cfg.MaxErrorClasses = n
+	}
+}
+
+// Output sets where the logo and summary are written (defaults to
+// stdout)
+func Output(w io.Writer) Option {
+	return func(cfg *Config) {
+		cfg.Output = w
+	}
+}
+
+// Rate limits the rate tests are started at, in tests per second
+// across all users (defaults to no limit)
+func Rate(rps float64) Option {
+	return func(cfg *Config) {
+		cfg.Rate = rps
+	}
+}
+
 // ShowLogo should the logo be displayed (defaults to true)
 func ShowLogo(b bool) Option {
 	return func(cfg *Config) {
@@ -144,6 +219,14 @@ func Percentiles(p []int) Option {
 	}
 }
 
+// Thresholds sets pass/fail criteria for the result, checked by RunT
+// and Result.Check
+func Thresholds(t ...Threshold) Option {
+	return func(cfg *Config) {
+		cfg.Thresholds = t
+	}
+}
+
 // Timeout sets test timout (defaults to 10 secs)
 func Timeout(t time.Duration) Option {
 	return func(cfg *Config) {
@@ -151,6 +234,15 @@ func Timeout(t time.Duration) Option {
 	}
 }
 
+// TotalIterations spreads n iterations over the users instead of
+// running Iterations per user. The first n%users users run one
+// iteration more than the others.
+func TotalIterations(n int) Option {
+	return func(cfg *Config) {
+		cfg.TotalIterations = n
+	}
+}
+
 // Users sets number of users
 func Users(users int) Option {
 	return func(cfg *Config) {
@@ -169,6 +261,31 @@ type RunnerHandler interface {
 	RunnerDone(res Result)
 }
 
+// UserHandler is an optional interface for runner handlers that want
+// to be notified when simulated users start and stop running tests.
+type UserHandler interface {
+	// UserStarted is called when a user starts running tests.
+	UserStarted(user int)
+	// UserDone is called when a user has run all its tests.
+	UserDone(user int)
+}
+
+// TestStartedHandler is an optional interface for runner handlers
+// that want to be notified when a test is started. Skipped tests are
+// never started.
+type TestStartedHandler interface {
+	// TestStarted is called right before a test is run.
+	TestStarted(id string, user, iteration int)
+}
+
+// ConfigHandler is an optional interface for runner handlers that want
+// the config of the runner, e.g. to store it along with the result.
+type ConfigHandler interface {
+	// RunnerConfig is called with the runner config before
+	// RunnerStarted.
+	RunnerConfig(cfg Config)
+}
+
 // Runner type
 type Runner struct {
 	cfg *Config
@@ -179,6 +296,8 @@ func NewRunner(options ...Option) *Runner {
 	cfg := &Config{
 		HistogramBuckets: DefaultHistogramBuckets,
 		Iterations:       1,
+		MaxErrorClasses:  DefaultMaxErrorClasses,
+		Output:           os.Stdout,
 		Percentiles:      DefaultPercentiles,
 		ShowLogo:         true,
 		ShowSummary:      true,
@@ -193,25 +312,60 @@ func NewRunner(options ...Option) *Runner {
 	return &Runner{cfg: cfg}
 }
 
+// Config returns a copy of the runner config
+func (r *Runner) Config() Config {
+	return *r.cfg
+}
+
+// With returns a copy of the runner with options applied
+func (r *Runner) With(options ...Option) *Runner {
+	cfg := *r.cfg
+	for _, opt := range options {
+		opt(&cfg)
+	}
+	return &Runner{cfg: &cfg}
+}
+
 // Run runs tests
 func (r *Runner) Run(ctx context.Context, tests ...testunit.TestUnit) Result {
 	if r.cfg.ShowLogo {
-		fmt.Printf("%s\n\n", asciilogo)
+		fmt.Fprintf(r.cfg.Output, "%s\n\n", asciilogo)
 	}
 
+	// The number of tests is unknown when running for a duration
 	count := len(tests) * r.cfg.Iterations * r.cfg.Users
+	if r.cfg.TotalIterations > 0 {
+		count = len(tests) * r.cfg.TotalIterations
+	}
+	if r.cfg.Duration > 0 {
+		count = 0
+	}
 
+	for _, h := range r.cfg.Handlers {
+		if ch, ok := h.(ConfigHandler); ok {
+			ch.RunnerConfig(*r.cfg)
+		}
+	}
 	for _, h := range r.cfg.Handlers {
 		h.RunnerStarted(r.cfg.ID, r.cfg.Description, count)
 	}
 
+	var limiter *runner.Limiter
+	if r.cfg.Rate > 0 {
+		limiter = runner.NewLimiter(r.cfg.Rate)
+	}
+	var deadline time.Time
+	if r.cfg.Duration > 0 {
+		deadline = time.Now().Add(r.cfg.Duration)
+	}
+
 	if r.cfg.Users == 1 {
-		res := r.run(ctx, tests...)
+		res := r.run(ctx, 0, deadline, limiter, tests...).CapErrors(r.cfg.MaxErrorClasses)
 		for _, h := range r.cfg.Handlers {
 			h.RunnerDone(res)
 		}
 		if r.cfg.ShowSummary {
-			showSummary(res)
+			showSummary(r.cfg.Output, res)
 		}
 		return res
 	}
@@ -222,19 +376,19 @@ func (r *Runner) Run(ctx context.Context, tests ...testunit.TestUnit) Result {
 
 	results := make([]Result, 0)
 	for i := 0; i < r.cfg.Users; i++ {
-		go func() {
+		go func(user int) {
 			defer wg.Done()
 			runner := NewRunner()
 			runner.cfg = r.cfg
-			res := runner.run(ctx, tests...)
+			res := runner.run(ctx, user, deadline, limiter, tests...)
 			mux.Lock()
 			defer mux.Unlock()
 			results = append(results, res)
-		}()
+		}(i)
 	}
 	wg.Wait()
 
-	sum := JoinResults(r.cfg.HistogramBuckets, r.cfg.Percentiles, results...)
+	sum := JoinResults(r.cfg.HistogramBuckets, r.cfg.Percentiles, results...).CapErrors(r.cfg.MaxErrorClasses)
 
 	// Notify handlers
 	for _, h := range r.cfg.Handlers {
@@ -242,27 +396,77 @@ func (r *Runner) Run(ctx context.Context, tests ...testunit.TestUnit) Result {
 	}
 
 	if r.cfg.ShowSummary {
-		showSummary(sum)
+		showSummary(r.cfg.Output, sum)
 	}
 
 	return sum
 }
 
+// UserIterations returns the number of iterations run by user, unless
+// the run is for a duration
+func (cfg Config) UserIterations(user int) int {
+	if cfg.TotalIterations <= 0 {
+		return cfg.Iterations
+	}
+	users := cfg.Users
+	if users < 1 {
+		users = 1
+	}
+	n := cfg.TotalIterations / users
+	if user < cfg.TotalIterations%users {
+		n++
+	}
+	return n
+}
+
 // Run runs tests
-func (r *Runner) run(ctx context.Context, tests ...testunit.TestUnit) Result {
+func (r *Runner) run(ctx context.Context, user int, deadline time.Time, limiter *runner.Limiter, tests ...testunit.TestUnit) Result {
 	if hasDuplicateIDs(tests) {
 		panic("tests have duplicate ids")
 	}
 
+	for _, h := range r.cfg.Handlers {
+		if uh, ok := h.(UserHandler); ok {
+			uh.UserStarted(user)
+		}
+	}
+	defer func() {
+		for _, h := range r.cfg.Handlers {
+			if uh, ok := h.(UserHandler); ok {
+				uh.UserDone(user)
+			}
+		}
+	}()
+
 	durations := make([]time.Duration, 0)
 
-	var skipped, errored int
-	testRunner := runner.New(r.cfg.Timeout, r.cfg.Iterations)
+	var count, skipped, errored, retried, retries int
+	testRunner := runner.New(r.cfg.Timeout, r.cfg.UserIterations(user))
+	testRunner.Deadline = deadline
+	testRunner.Limiter = limiter
+	if !deadline.IsZero() {
+		testRunner.Iterations = 0
+	}
 
-	errorm := make(map[string]int)
+	errs := newErrorSet()
+	errs.max = r.cfg.MaxErrorClasses
+	counters := make(map[string]int64)
+	phases := make(map[string][]time.Duration)
+	metrics := make(metricSet)
 	testStats := make(map[string]TestStats)
-	testRunner.TestUnitDone = func(t testunit.TestUnit, timer *runner.Timer, err error) {
+	testRunner.TestUnitStarted = func(t testunit.TestUnit, iteration int) {
+		for _, h := range r.cfg.Handlers {
+			if sh, ok := h.(TestStartedHandler); ok {
+				sh.TestStarted(t.ID(), user, iteration)
+			}
+		}
+	}
+	testRunner.TestUnitDone = func(t testunit.TestUnit, iteration int, timer *runner.Timer, rec *testunit.Recorder, err error) {
+		count++
 		enabled, description := t.Enabled()
+		if errors.Is(err, testunit.ErrExhausted) {
+			enabled, description, err = false, err.Error(), nil
+		}
 
 		// Set test outcome
 		outcome := func() testunit.TestOutcome {
@@ -275,14 +479,28 @@ func (r *Runner) run(ctx context.Context, tests ...testunit.TestUnit) Result {
 		}()
 
 		// Set result
+		attempts := rec.Attempts()
+		if attempts == 0 && outcome != testunit.Skip {
+			attempts = 1
+		}
 		testResult := TestResult{
-			Date:     time.Now(),
-			Duration: timer.Duration,
-			End:      timer.End,
-			Error:    err,
-			ID:       t.ID(),
-			Outcome:  outcome,
-			Start:    timer.Start,
+			Attempts:   attempts,
+			Counters:   rec.Counters(),
+			Date:       time.Now(),
+			Duration:   timer.Duration,
+			End:        timer.End,
+			Error:      err,
+			Gauges:     rec.Gauges(),
+			Histograms: rec.Values(),
+			ID:         t.ID(),
+			Iteration:  iteration,
+			Outcome:    outcome,
+			Record:     rec.Record(),
+			Start:      timer.Start,
+			Tags:       testTags(t, rec),
+			Timings:    rec.Timings(),
+			Trends:     rec.Trends(),
+			User:       user,
 		}
 
 		// Handle the test outcome
@@ -292,11 +510,25 @@ func (r *Runner) run(ctx context.Context, tests ...testunit.TestUnit) Result {
 			testResult.Comment = description
 		case testunit.Fail:
 			errored++
-			errorm[err.Error()]++
 			testResult.Comment = err.Error()
+			testResult.ErrorClass = classifyError(r.cfg.ErrorClassifiers, err)
+			errs.addResult(testResult)
 		case testunit.Pass:
 			durations = append(durations, timer.Duration)
+			for k, v := range testResult.Timings {
+				phases[k] = append(phases[k], v)
+			}
+			if attempts > 1 {
+				retried++
+			}
+		}
+		if attempts > 1 {
+			retries += attempts - 1
+		}
+		for k, v := range testResult.Counters {
+			counters[k] += v
 		}
+		metrics.addResult(testResult)
 
 		// Append result to previous results
 		v, ok := testStats[t.ID()]
@@ -316,10 +548,9 @@ func (r *Runner) run(ctx context.Context, tests ...testunit.TestUnit) Result {
 	}
 
 	// Run the tests
-	timer := testRunner.Run(ctx, tests...)
+	timer := testRunner.Run(testunit.WithUser(ctx, user), tests...)
 
 	// Gather stats
-	count := len(tests) * r.cfg.Iterations
 	passed := count - errored - skipped
 	avg := avgDuration(timer.Duration, passed)
 
@@ -344,15 +575,21 @@ func (r *Runner) run(ctx context.Context, tests ...testunit.TestUnit) Result {
 	stats := Stats{
 		Average:       avg,
 		Count:         count,
+		Counters:      counters,
 		Distributions: distributions,
 		Durations:     durations,
 		Duration:      timer.Duration,
-		Errorm:        errorm,
+		Errorm:        errs.counts,
 		Errors:        errored,
+		ErrorSamples:  errs.samples,
 		Fastest:       fastest,
 		End:           timer.End,
 		Histogram:     histogram,
+		Metrics:       metrics.stats(r.cfg.Percentiles),
 		Passed:        passed,
+		PassedRetried: retried,
+		Phases:        phaseStats(r.cfg.Percentiles, phases),
+		Retries:       retries,
 		RPS:           rps,
 		Skips:         skipped,
 		Slowest:       slowest,
@@ -375,12 +612,20 @@ func calcTestStats(buckets int, percentiles []int, testStats map[string]TestStat
 		var accduration time.Duration
 		starts := make([]time.Time, 0)
 		ends := make([]time.Time, 0)
-		errorm := make(map[string]int)
-		ok, skips, err := 0, 0, 0
+		errs := newErrorSet()
+		counters := make(map[string]int64)
+		phases := make(map[string][]time.Duration)
+		metrics := make(metricSet)
+		ok, skips, err, retried, retries := 0, 0, 0, 0, 0
 		for _, r := range v.TestResults {
-			if r.Error != nil {
-				errorm[r.Error.Error()]++
+			if r.Attempts > 1 {
+				retries += r.Attempts - 1
 			}
+			errs.addResult(r)
+			for k, n := range r.Counters {
+				counters[k] += n
+			}
+			metrics.addResult(r)
 			accduration += r.Duration
 			if !r.Start.IsZero() {
 				starts = append(starts, r.Start)
@@ -389,7 +634,13 @@ func calcTestStats(buckets int, percentiles []int, testStats map[string]TestStat
 			switch r.Outcome {
 			case testunit.Pass:
 				ok++
+				if r.Attempts > 1 {
+					retried++
+				}
 				durations = append(durations, r.Duration)
+				for k, d := range r.Timings {
+					phases[k] = append(phases[k], d)
+				}
 			case testunit.Fail:
 				err++
 			case testunit.Skip:
@@ -433,14 +684,20 @@ func calcTestStats(buckets int, percentiles []int, testStats map[string]TestStat
 		c := len(v.TestResults)
 		v.Stats.Average = avgDuration(accduration, ok)
 		v.Stats.Count = c
+		v.Stats.Counters = counters
 		v.Stats.Distributions = dist
 		v.Stats.Duration = duration
 		v.Stats.Durations = durations
 		v.Stats.Errors = err
-		v.Stats.Errorm = errorm
+		v.Stats.Errorm = errs.counts
+		v.Stats.ErrorSamples = errs.samples
 		v.Stats.Fastest = fastest
 		v.Stats.Histogram = hist
+		v.Stats.Metrics = metrics.stats(percentiles)
 		v.Stats.Passed = ok
+		v.Stats.PassedRetried = retried
+		v.Stats.Phases = phaseStats(percentiles, phases)
+		v.Stats.Retries = retries
 		v.Stats.Skips = skips
 		v.Stats.Slowest = slowest
 
@@ -454,26 +711,55 @@ func calcTestStats(buckets int, percentiles []int, testStats map[string]TestStat
 	}
 }
 
+// Resolution returns the number of histogram buckets and the
+// percentiles the result was computed with, falling back to the
+// defaults
+func (r Result) Resolution() (int, []int) {
+	buckets, percentiles := DefaultHistogramBuckets, DefaultPercentiles
+	if n := len(r.Stats.Histogram); n > 0 {
+		buckets = n - 1
+	}
+	// Distributions without latencies have no percentage
+	var ps []int
+	for _, d := range r.Stats.Distributions {
+		if d.Percentage > 0 {
+			ps = append(ps, d.Percentage)
+		}
+	}
+	if len(ps) > 0 {
+		percentiles = ps
+	}
+	return buckets, percentiles
+}
+
 // JoinResults joins results to a combined result
 func JoinResults(histogramBuckets int, percentiles []int, results ...Result) Result {
-	count, ok, skips, err := 0, 0, 0, 0
+	count, ok, skips, err, retried, retries := 0, 0, 0, 0, 0, 0
 	var accduration time.Duration
 	starts := make([]time.Time, 0)
 	ends := make([]time.Time, 0)
 	durations := make([]time.Duration, 0)
-	errorm := make(map[string]int)
+	errs := newErrorSet()
+	counters := make(map[string]int64)
+	phases := make(map[string][]time.Duration)
 	for _, r := range results {
 		count += r.Stats.Count
+		for k, v := range r.Stats.Counters {
+			counters[k] += v
+		}
+		for k, v := range r.Stats.Phases {
+			phases[k] = append(phases[k], v.Durations...)
+		}
 		accduration += r.Stats.Duration
 		err += r.Stats.Errors
-		for k, v := range r.Stats.Errorm {
-			errorm[k] += v
-		}
+		errs.addStats(r.Stats)
 		if !r.Stats.Start.IsZero() {
 			starts = append(starts, r.Stats.Start)
 			ends = append(ends, r.Stats.End)
 		}
 		skips += r.Stats.Skips
+		retried += r.Stats.PassedRetried
+		retries += r.Stats.Retries
 		ok += r.Stats.Count - r.Stats.Skips - r.Stats.Errors
 		durations = append(durations, r.Stats.Durations...)
 	}
@@ -526,6 +812,15 @@ func JoinResults(histogramBuckets int, percentiles []int, results ...Result) Res
 	// Collect all test stats
 	calcTestStats(histogramBuckets, percentiles, testStats)
 
+	// The metric values are not kept in saved results, so the metrics
+	// are joined from the test results
+	metrics := make(metricSet)
+	for _, v := range testStats {
+		for _, r := range v.TestResults {
+			metrics.addResult(r)
+		}
+	}
+
 	rps := float64(0)
 	if totalDuration > 0 {
 		rps = float64(ok+err) / totalDuration.Seconds()
@@ -534,15 +829,21 @@ func JoinResults(histogramBuckets int, percentiles []int, results ...Result) Res
 	stats := Stats{
 		Average:       avg,
 		Count:         count,
+		Counters:      counters,
 		Distributions: dist,
 		Duration:      totalDuration,
 		Durations:     durations,
 		End:           end,
 		Errors:        err,
-		Errorm:        errorm,
+		Errorm:        errs.counts,
+		ErrorSamples:  errs.samples,
 		Fastest:       fastest,
 		Histogram:     hist,
+		Metrics:       metrics.stats(percentiles),
 		Passed:        ok,
+		PassedRetried: retried,
+		Phases:        phaseStats(percentiles, phases),
+		Retries:       retries,
 		RPS:           rps,
 		Skips:         skips,
 		Slowest:       slowest,
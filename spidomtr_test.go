@@ -182,6 +182,89 @@ func TestRunnerWithUsers(t *testing.T) {
 	require.Equal(t, 1500, res.Stats.Count)
 }
 
+func TestRunnerWithDuration(t *testing.T) {
+	runner := spidomtr.NewRunner(
+		spidomtr.Duration(50*time.Millisecond),
+		spidomtr.ShowLogo(false),
+		spidomtr.ShowSummary(false),
+		spidomtr.Users(4),
+	)
+
+	test := testunit.New(
+		testunit.Test(func(context.Context, []interface{}) ([]interface{}, error) {
+			time.Sleep(1 * time.Millisecond)
+			return nil, nil
+		}),
+	)
+
+	start := time.Now()
+	res := runner.Run(context.Background(), test)
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	require.Less(t, time.Since(start), time.Second)
+	require.Greater(t, res.Stats.Count, 4)
+	require.Equal(t, res.Stats.Count, res.Stats.Passed)
+}
+
+func TestRunnerWithTotalIterations(t *testing.T) {
+	runner := spidomtr.NewRunner(
+		spidomtr.ShowLogo(false),
+		spidomtr.ShowSummary(false),
+		spidomtr.TotalIterations(10),
+		spidomtr.Users(4),
+	)
+
+	res := runner.Run(context.Background(), testunit.New(testunit.ID("test")))
+	require.Equal(t, 10, res.Stats.Passed)
+	users := make(map[int]int)
+	for _, tr := range res.TestStats["test"].TestResults {
+		users[tr.User]++
+	}
+	require.Equal(t, map[int]int{0: 3, 1: 3, 2: 2, 3: 2}, users)
+}
+
+func TestRunnerWithRate(t *testing.T) {
+	runner := spidomtr.NewRunner(
+		spidomtr.Iterations(5),
+		spidomtr.Rate(200),
+		spidomtr.ShowLogo(false),
+		spidomtr.ShowSummary(false),
+		spidomtr.Users(4),
+	)
+
+	start := time.Now()
+	res := runner.Run(context.Background(), testunit.New())
+	require.Equal(t, 20, res.Stats.Passed)
+	// 20 tests at 200/s are started over at least 95ms
+	require.GreaterOrEqual(t, time.Since(start), 95*time.Millisecond)
+}
+
+func TestRunnerCanceled(t *testing.T) {
+	test := testunit.New(
+		testunit.Test(func(context.Context, []interface{}) ([]interface{}, error) {
+			time.Sleep(5 * time.Millisecond)
+			return nil, nil
+		}),
+	)
+
+	for _, rate := range []float64{0, 100} {
+		runner := spidomtr.NewRunner(
+			spidomtr.Iterations(1000),
+			spidomtr.Rate(rate),
+			spidomtr.ShowLogo(false),
+			spidomtr.ShowSummary(false),
+			spidomtr.Users(2),
+		)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		res := runner.Run(ctx, test)
+		cancel()
+
+		// The users stop on cancel instead of running the remaining
+		// iterations
+		require.Less(t, res.Stats.Count, 100, rate)
+		require.Equal(t, 0, res.Stats.Errors, rate)
+	}
+}
+
 func TestHandlers(t *testing.T) {
 	runner := spidomtr.NewRunner(
 		spidomtr.HistogramBuckets(5),
@@ -1,6 +1,9 @@
 package spidomtr
 
-import "time"
+import (
+	"sort"
+	"time"
+)
 
 // Bucket type
 type Bucket struct {
@@ -15,6 +18,41 @@ type LatencyDist struct {
 	Latency    time.Duration
 }
 
+// PhaseStats type
+type PhaseStats struct {
+	Average       time.Duration
+	Count         int
+	Distributions []LatencyDist
+	Durations     []time.Duration
+	Fastest       time.Duration
+	Slowest       time.Duration
+}
+
+func phaseStats(percentiles []int, phases map[string][]time.Duration) map[string]PhaseStats {
+	if len(phases) == 0 {
+		return nil
+	}
+	res := make(map[string]PhaseStats, len(phases))
+	for name, durations := range phases {
+		sort.Slice(durations, func(i, j int) bool {
+			return durations[i] < durations[j]
+		})
+		var acc time.Duration
+		for _, d := range durations {
+			acc += d
+		}
+		res[name] = PhaseStats{
+			Average:       avgDuration(acc, len(durations)),
+			Count:         len(durations),
+			Distributions: distributions(percentiles, durations),
+			Durations:     durations,
+			Fastest:       durations[0],
+			Slowest:       durations[len(durations)-1],
+		}
+	}
+	return res
+}
+
 func avgDuration(duration time.Duration, total int) time.Duration {
 	if total == 0 {
 		return 0
@@ -22,23 +60,31 @@ func avgDuration(duration time.Duration, total int) time.Duration {
 	return duration / time.Duration(total)
 }
 
-func distributions(percentiles []int, latencies []time.Duration) []LatencyDist {
-	data := make([]time.Duration, len(percentiles))
-	for i, j := 0, 0; i < len(latencies) && j < len(percentiles); i++ {
-		current := i * 100 / len(latencies)
-
-		if current >= percentiles[j] {
-			data[j] = latencies[i]
-			j++
-		}
+// percentile returns the pth percentile of values by the nearest rank
+// method, where values must be sorted in ascending order
+func percentile[T ~int64 | ~float64](values []T, p int) T {
+	if len(values) == 0 {
+		return 0
 	}
+	i := (len(values)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return values[i]
+}
 
+// Percentile returns the pth percentile of the latencies
+func (s Stats) Percentile(p int) time.Duration {
+	return percentile(s.Durations, p)
+}
+
+func distributions(percentiles []int, latencies []time.Duration) []LatencyDist {
 	res := make([]LatencyDist, len(percentiles))
-	for i := 0; i < len(percentiles); i++ {
-		if data[i] > 0 {
-			lat := data[i]
-			res[i] = LatencyDist{Percentage: percentiles[i], Latency: lat}
-		}
+	if len(latencies) == 0 {
+		return res
+	}
+	for i, p := range percentiles {
+		res[i] = LatencyDist{Percentage: p, Latency: percentile(latencies, p)}
 	}
 	return res
 }
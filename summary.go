@@ -3,6 +3,7 @@ package spidomtr
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"sort"
 	"strconv"
 	"strings"
@@ -16,86 +17,216 @@ const (
 	skipMark  = "-"
 )
 
-func showSummary(res Result) {
+// WriteSummary writes the text summary of res to w, as shown after a
+// run
+func WriteSummary(w io.Writer, res Result) {
+	showSummary(w, res)
+}
+
+func showSummary(w io.Writer, res Result) {
 	// Total test summary
-	fmt.Print("\nSummary:\n")
-	fmt.Printf("%2s%-10s %d\n", "", "Count:", res.Stats.Count)
-	fmt.Printf("%2s%-10s %s\n", "", "Total:", res.Stats.Duration)
-	fmt.Printf("%2s%-10s %d ms\n", "", "Slowest:", int64(res.Stats.Slowest/time.Millisecond))
-	fmt.Printf("%2s%-10s %d ms\n", "", "Fastest:", int64(res.Stats.Fastest/time.Millisecond))
-	fmt.Printf("%2s%-10s %d ms\n", "", "Average:", int64(res.Stats.Average/time.Millisecond))
-	fmt.Printf("%2s%-10s %4.2f\n", "", "Req/sec:", res.Stats.RPS)
+	fmt.Fprint(w, "\nSummary:\n")
+	fmt.Fprintf(w, "%2s%-10s %d\n", "", "Count:", res.Stats.Count)
+	fmt.Fprintf(w, "%2s%-10s %s\n", "", "Total:", res.Stats.Duration)
+	fmt.Fprintf(w, "%2s%-10s %d ms\n", "", "Slowest:", int64(res.Stats.Slowest/time.Millisecond))
+	fmt.Fprintf(w, "%2s%-10s %d ms\n", "", "Fastest:", int64(res.Stats.Fastest/time.Millisecond))
+	fmt.Fprintf(w, "%2s%-10s %d ms\n", "", "Average:", int64(res.Stats.Average/time.Millisecond))
+	fmt.Fprintf(w, "%2s%-10s %4.2f\n", "", "Req/sec:", res.Stats.RPS)
 
 	// Response time histogram
-	fmt.Print("\nResponse time histogram:\n")
-	fmt.Print(histogramStr(res.Stats.Histogram))
+	fmt.Fprint(w, "\nResponse time histogram:\n")
+	fmt.Fprint(w, histogramStr(res.Stats.Histogram))
 
 	// Latency distributions
-	fmt.Print("\nLatency distribution:\n")
+	fmt.Fprint(w, "\nLatency distribution:\n")
 	for _, d := range res.Stats.Distributions {
 		if d.Latency > 0 && d.Percentage > 0 {
-			fmt.Printf("%2s%d%% in %d ms\n", "", d.Percentage, int64(d.Latency/time.Millisecond))
+			fmt.Fprintf(w, "%2s%d%% in %d ms\n", "", d.Percentage, int64(d.Latency/time.Millisecond))
+		}
+	}
+
+	// Phase latencies
+	if len(res.Stats.Phases) > 0 {
+		fmt.Fprint(w, "\nPhase latencies (average, fastest, slowest):\n")
+		for _, name := range sortedKeys(res.Stats.Phases) {
+			p := res.Stats.Phases[name]
+			fmt.Fprintf(w, "%2s%-16s %s, %s, %s\n", "", name+":", msStr(p.Average), msStr(p.Fastest), msStr(p.Slowest))
+			for _, d := range p.Distributions {
+				if d.Latency > 0 && d.Percentage >= 50 {
+					fmt.Fprintf(w, "%4s%d%% in %s\n", "", d.Percentage, msStr(d.Latency))
+				}
+			}
 		}
 	}
 
 	// Responses
-	fmt.Print("\nResponses:\n")
-	fmt.Printf("%2s%-10s %d\n", "", "OK:", res.Stats.Passed)
-	fmt.Printf("%2s%-10s %d\n", "", "Errored:", res.Stats.Errors)
-	fmt.Printf("%2s%-10s %d\n", "", "Skipped:", res.Stats.Skips)
+	fmt.Fprint(w, "\nResponses:\n")
+	fmt.Fprintf(w, "%2s%-10s %d\n", "", "OK:", res.Stats.Passed)
+	fmt.Fprintf(w, "%2s%-10s %d\n", "", "Errored:", res.Stats.Errors)
+	fmt.Fprintf(w, "%2s%-10s %d\n", "", "Skipped:", res.Stats.Skips)
+	if res.Stats.Retries > 0 {
+		fmt.Fprintf(w, "%2s%-10s %d (%d passed after retry)\n", "", "Retries:", res.Stats.Retries, res.Stats.PassedRetried)
+	}
 
 	// Print error distribution
 	if len(res.Stats.Errorm) > 0 {
-		keys := make([]string, 0, len(res.Stats.Errorm))
-		for k := range res.Stats.Errorm {
-			keys = append(keys, k)
+		fmt.Fprint(w, "\nError distribution:\n")
+		for _, err := range sortedErrors(res.Stats.Errorm) {
+			fmt.Fprintf(w, "%2s[%v] %s\n", "", res.Stats.Errorm[err], err)
+			for _, sample := range errorSamples(res.Stats, err) {
+				fmt.Fprintf(w, "%6s%s\n", "", sample)
+			}
+		}
+	}
+
+	// Print counters reported by the tests
+	if len(res.Stats.Counters) > 0 {
+		fmt.Fprint(w, "\nCounters:\n")
+		for _, k := range sortedKeys(res.Stats.Counters) {
+			fmt.Fprintf(w, "%2s%-18s %d\n", "", k+":", res.Stats.Counters[k])
 		}
-		sort.Strings(keys)
+	}
 
-		fmt.Print("\nError distribution:\n")
-		for _, err := range keys {
-			fmt.Printf("%2s[%v] %s\n", "", res.Stats.Errorm[err], err)
+	// Print custom metrics reported by the tests
+	if len(res.Stats.Metrics) > 0 {
+		fmt.Fprint(w, "\nMetrics:\n")
+		for _, k := range sortedKeys(res.Stats.Metrics) {
+			fmt.Fprintf(w, "%2s%-18s %s\n", "", k+":", metricStr(res.Stats.Metrics[k]))
 		}
 	}
 
 	// Print stats on each test
-	fmt.Print("\nTests:\n")
+	fmt.Fprint(w, "\nTests:\n")
 	for k, testStats := range res.TestStats {
-		fmt.Print("\n")
-		fmt.Printf("%2s%-10s\n", "", toMark(testStats)+" "+k)
-		fmt.Printf("%4s%-10s %v\n", "", "Count:", testStats.Stats.Count)
-		fmt.Printf("%4s%-10s %v\n", "", "OK:", testStats.Stats.Passed)
-		fmt.Printf("%4s%-10s %v\n", "", "Errored:", testStats.Stats.Errors)
-		fmt.Printf("%4s%-10s %v\n", "", "Skipped:", testStats.Stats.Skips)
+		fmt.Fprint(w, "\n")
+		fmt.Fprintf(w, "%2s%-10s\n", "", toMark(testStats)+" "+k)
+		fmt.Fprintf(w, "%4s%-10s %v\n", "", "Count:", testStats.Stats.Count)
+		fmt.Fprintf(w, "%4s%-10s %v\n", "", "OK:", testStats.Stats.Passed)
+		fmt.Fprintf(w, "%4s%-10s %v\n", "", "Errored:", testStats.Stats.Errors)
+		fmt.Fprintf(w, "%4s%-10s %v\n", "", "Skipped:", testStats.Stats.Skips)
 		if testStats.Stats.Slowest > 0 {
-			fmt.Printf("%4s%-10s %v ms\n", "", "Slowest:", int64(testStats.Stats.Slowest/time.Millisecond))
+			fmt.Fprintf(w, "%4s%-10s %v ms\n", "", "Slowest:", int64(testStats.Stats.Slowest/time.Millisecond))
 		}
 		if testStats.Stats.Fastest > 0 {
-			fmt.Printf("%4s%-10s %v ms\n", "", "Fastest:", int64(testStats.Stats.Fastest/time.Millisecond))
+			fmt.Fprintf(w, "%4s%-10s %v ms\n", "", "Fastest:", int64(testStats.Stats.Fastest/time.Millisecond))
 		}
 		if testStats.Stats.Average > 0 {
-			fmt.Printf("%4s%-10s %v ms\n", "", "Average:", int64(testStats.Stats.Average/time.Millisecond))
+			fmt.Fprintf(w, "%4s%-10s %v ms\n", "", "Average:", int64(testStats.Stats.Average/time.Millisecond))
 		}
 
 		for _, d := range testStats.Stats.Distributions {
 			if d.Percentage >= 90 {
 				strlatency := strconv.FormatInt(int64(d.Latency/time.Millisecond), 10)
-				fmt.Printf("%4s%-10s %s ms\n", "", strconv.Itoa(d.Percentage)+"%:", strlatency)
+				fmt.Fprintf(w, "%4s%-10s %s ms\n", "", strconv.Itoa(d.Percentage)+"%:", strlatency)
 			}
 		}
 
 		if testStats.Stats.RPS > 0 {
-			fmt.Printf("%4s%-10s %4.2f\n", "", "Req/sec:", testStats.Stats.RPS)
+			fmt.Fprintf(w, "%4s%-10s %4.2f\n", "", "Req/sec:", testStats.Stats.RPS)
+		}
+
+		// Print phase latencies
+		if len(testStats.Stats.Phases) > 0 {
+			fmt.Fprintf(w, "%4s%-10s\n", "", "Phases:")
+			for _, name := range sortedKeys(testStats.Stats.Phases) {
+				p := testStats.Stats.Phases[name]
+				str := "avg " + msStr(p.Average)
+				for _, d := range p.Distributions {
+					if d.Percentage >= 90 {
+						str += ", " + strconv.Itoa(d.Percentage) + "% " + msStr(d.Latency)
+					}
+				}
+				fmt.Fprintf(w, "%8s%-16s %s\n", "", name+":", str)
+			}
 		}
 
 		// Print error distribution
 		if len(testStats.Stats.Errorm) > 0 {
-			fmt.Printf("%4s%-10s\n", "", "Errors:")
-			for err, count := range testStats.Stats.Errorm {
-				fmt.Printf("%8s[%v] %s\n", "", count, err)
+			fmt.Fprintf(w, "%4s%-10s\n", "", "Errors:")
+			for _, err := range sortedErrors(testStats.Stats.Errorm) {
+				fmt.Fprintf(w, "%8s[%v] %s\n", "", testStats.Stats.Errorm[err], err)
+				for _, sample := range errorSamples(testStats.Stats, err) {
+					fmt.Fprintf(w, "%12s%s\n", "", sample)
+				}
+			}
+		}
+
+		// Print counters
+		if len(testStats.Stats.Counters) > 0 {
+			fmt.Fprintf(w, "%4s%-10s\n", "", "Counters:")
+			for _, k := range sortedKeys(testStats.Stats.Counters) {
+				fmt.Fprintf(w, "%8s%-18s %d\n", "", k+":", testStats.Stats.Counters[k])
+			}
+		}
+
+		// Print custom metrics
+		if len(testStats.Stats.Metrics) > 0 {
+			fmt.Fprintf(w, "%4s%-10s\n", "", "Metrics:")
+			for _, k := range sortedKeys(testStats.Stats.Metrics) {
+				fmt.Fprintf(w, "%8s%-18s %s\n", "", k+":", metricStr(testStats.Stats.Metrics[k]))
+			}
+		}
+	}
+}
+
+func msStr(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 2, 64) + " ms"
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedErrors returns the error classes, with OtherErrors last
+func sortedErrors(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		if k != OtherErrors {
+			keys = append(keys, k)
+		}
+	}
+	if _, ok := m[OtherErrors]; ok {
+		keys = append(keys, OtherErrors)
+	}
+	return keys
+}
+
+// errorSamples returns the sample messages of an error class, unless
+// the class is the only message
+func errorSamples(stats Stats, class string) []string {
+	samples := stats.ErrorSamples[class]
+	if len(samples) == 1 && samples[0] == class {
+		return nil
+	}
+	return samples
+}
+
+// metricStr summarizes a custom metric, e.g. "avg 12.5, min 1, max 40,
+// 90% 33, 99% 40"
+func metricStr(m MetricStats) string {
+	var parts []string
+	if m.Kind == GaugeKind {
+		parts = append(parts, "last "+formatValue(m.Kind, m.Last))
+	}
+	parts = append(parts,
+		"avg "+formatValue(m.Kind, m.Mean),
+		"min "+formatValue(m.Kind, m.Min),
+		"max "+formatValue(m.Kind, m.Max),
+	)
+	if m.Kind != GaugeKind {
+		for _, d := range m.Distributions {
+			if d.Percentage >= 90 {
+				parts = append(parts, strconv.Itoa(d.Percentage)+"% "+formatValue(m.Kind, d.Value))
 			}
 		}
 	}
+	return strings.Join(parts, ", ")
 }
 
 func histogramStr(buckets []Bucket) string {
@@ -0,0 +1,87 @@
+package spidomtr
+
+import (
+	"strings"
+
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+)
+
+// testTags returns the tags of t, overridden by the tags set during the
+// test run
+func testTags(t testunit.TestUnit, rec *testunit.Recorder) map[string]string {
+	var tags map[string]string
+	if tt, ok := t.(testunit.TaggedTestUnit); ok {
+		tags = tt.Tags()
+	}
+	for k, v := range rec.Tags() {
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+		tags[k] = v
+	}
+	return tags
+}
+
+// GroupBy returns the stats of the test results grouped by the value of
+// the tag key, e.g. by "region". Test results without the tag are left
+// out.
+func (r Result) GroupBy(key string) map[string]TestStats {
+	groups := make(map[string]TestStats)
+	for _, tr := range r.testResults() {
+		v, ok := tr.Tags[key]
+		if !ok {
+			continue
+		}
+		ts := groups[v]
+		ts.TestResults = append(ts.TestResults, tr)
+		groups[v] = ts
+	}
+	buckets, percentiles := r.Resolution()
+	calcTestStats(buckets, percentiles, groups)
+	return groups
+}
+
+// filter returns the stats of the test results matching the test ID, if
+// not empty, and all tags
+func (r Result) filter(id string, tags map[string]string) TestStats {
+	var ts TestStats
+	for _, tr := range r.testResults() {
+		if (id == "" || tr.ID == id) && hasTags(tr, tags) {
+			ts.TestResults = append(ts.TestResults, tr)
+		}
+	}
+	m := map[string]TestStats{id: ts}
+	buckets, percentiles := r.Resolution()
+	calcTestStats(buckets, percentiles, m)
+	return m[id]
+}
+
+// testResults returns the results of all tests, ordered by test ID
+func (r Result) testResults() []TestResult {
+	var results []TestResult
+	for _, id := range sortedKeys(r.TestStats) {
+		results = append(results, r.TestStats[id].TestResults...)
+	}
+	return results
+}
+
+func hasTags(tr TestResult, tags map[string]string) bool {
+	for k, v := range tags {
+		if tr.Tags[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// tagsStr formats tags ordered by key, e.g. "{method=GET,region=eu}"
+func tagsStr(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	keys := sortedKeys(tags)
+	for i, k := range keys {
+		keys[i] = k + "=" + tags[k]
+	}
+	return "{" + strings.Join(keys, ",") + "}"
+}
@@ -0,0 +1,66 @@
+package spidomtr_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTags(t *testing.T) {
+	test1 := testunit.New(
+		testunit.ID("items"),
+		testunit.Tags(map[string]string{"endpoint": "items", "region": "eu"}),
+		testunit.Test(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			// Odd iterations are served from another region
+			if testunit.Iteration(ctx)%2 == 1 {
+				testunit.Tag(ctx, "region", "us")
+			}
+			return args, nil
+		}),
+	)
+
+	test2 := testunit.New(
+		testunit.ID("users"),
+		testunit.Tags(map[string]string{"endpoint": "users", "region": "eu"}),
+		testunit.Test(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			// Odd iterations are served from another region
+			if testunit.Iteration(ctx)%2 == 1 {
+				testunit.Tag(ctx, "region", "ap")
+			}
+			return args, nil
+		}),
+	)
+
+	runner := spidomtr.NewRunner(
+		spidomtr.Iterations(4),
+		spidomtr.ShowLogo(false),
+		spidomtr.ShowSummary(false),
+	)
+	res := runner.Run(context.Background(), test1, test2)
+
+	items := res.TestStats["items"].TestResults
+	require.Equal(t, map[string]string{"endpoint": "items", "region": "eu"}, items[0].Tags)
+	require.Equal(t, map[string]string{"endpoint": "items", "region": "us"}, items[1].Tags)
+
+	regions := res.GroupBy("region")
+	require.Len(t, regions, 3)
+	require.Equal(t, 4, regions["eu"].Stats.Count)
+	require.Equal(t, 2, regions["us"].Stats.Count)
+	require.Equal(t, 2, regions["ap"].Stats.Count)
+	require.Len(t, res.GroupBy("endpoint"), 2)
+	require.Empty(t, res.GroupBy("missing"))
+
+	violations := res.Check(
+		spidomtr.MustParseThreshold("count == 4").ForTags(map[string]string{"region": "eu"}),
+		spidomtr.MustParseThreshold("count == 2").ForTags(map[string]string{"region": "eu"}).ForTest("items"),
+		spidomtr.MustParseThreshold("count == 1").ForTags(map[string]string{"endpoint": "users", "region": "ap"}),
+		spidomtr.MustParseThreshold("count > 0").ForTags(map[string]string{"region": "sa"}),
+	)
+	require.Len(t, violations, 2)
+	require.Equal(t, "{endpoint=users,region=ap}: expected count == 1, observed count = 2", violations[0].String())
+	require.Equal(t, "{region=sa}: expected count > 0, observed no results", violations[1].String())
+	require.Equal(t, "items{region=eu}: count == 2", spidomtr.MustParseThreshold("count == 2").ForTest("items").ForTags(map[string]string{"region": "eu"}).String())
+}
@@ -0,0 +1,135 @@
+package spidomtr
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+)
+
+// ShortScale is the factor iterations are scaled down by when RunT is
+// run with go test -short
+const ShortScale = 10
+
+// RunT runs the tests as part of a go test. Each test is reported as a
+// subtest of t, which fails if the test has errors or if it breaks any
+// of the runner's thresholds applied to it. Errors of a test with a
+// threshold on errors or error_rate only fail it by breaking that
+// threshold, where thresholds on the total stats apply to all tests
+// and thresholds filtered by tags to the tests with matching results.
+// Thresholds on the total stats are checked on t itself, which also
+// fails if a threshold names a test that is not run. The summary is
+// logged with t.Log instead of printed to stdout, and with -short,
+// iterations are scaled down by ShortScale.
+func RunT(t testing.TB, runner *Runner, tests ...testunit.TestUnit) Result {
+	t.Helper()
+
+	cfg := runner.Config()
+	iterations := cfg.Iterations
+	if testing.Short() {
+		iterations = max(1, iterations/ShortScale)
+	}
+
+	ctx := context.Background()
+	if dt, ok := t.(interface {
+		Deadline() (deadline time.Time, ok bool)
+	}); ok {
+		if deadline, ok := dt.Deadline(); ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, deadline)
+			defer cancel()
+		}
+	}
+
+	summary := &strings.Builder{}
+	res := runner.With(
+		Iterations(iterations),
+		Output(summary),
+		ShowLogo(false),
+	).Run(ctx, tests...)
+	if summary.Len() > 0 {
+		t.Log(summary.String())
+	}
+
+	ids := make(map[string]bool, len(tests))
+	for _, test := range tests {
+		ids[test.ID()] = true
+	}
+	for _, th := range cfg.Thresholds {
+		if th.TestID != "" && !ids[th.TestID] {
+			t.Errorf("unknown test in threshold %s", th)
+		}
+	}
+
+	// Tests with error thresholds, where "" is all tests
+	allowErrors := make(map[string]bool)
+	for _, th := range cfg.Thresholds {
+		if th.Metric != "errors" && th.Metric != "error_rate" {
+			continue
+		}
+		if len(th.Tags) == 0 {
+			allowErrors[th.TestID] = true
+			continue
+		}
+		for _, tr := range res.testResults() {
+			if (th.TestID == "" || tr.ID == th.TestID) && hasTags(tr, th.Tags) {
+				allowErrors[tr.ID] = true
+			}
+		}
+	}
+
+	for _, test := range tests {
+		id := test.ID()
+		check := func(tb testing.TB) {
+			tb.Helper()
+			stats := res.TestStats[id].Stats
+			if !allowErrors[""] && !allowErrors[id] && stats.Errors > 0 {
+				tb.Errorf("%d/%d failed: %s", stats.Errors, stats.Count, errorSummary(stats.Errorm))
+			}
+			for _, th := range cfg.Thresholds {
+				if th.TestID != id {
+					continue
+				}
+				for _, v := range res.Check(th) {
+					tb.Error(v)
+				}
+			}
+		}
+
+		if tt, ok := t.(*testing.T); ok {
+			tt.Run(id, func(t *testing.T) {
+				check(t)
+			})
+		} else {
+			check(t)
+		}
+	}
+
+	for _, th := range cfg.Thresholds {
+		if th.TestID != "" {
+			continue
+		}
+		for _, v := range res.Check(th) {
+			t.Error(v)
+		}
+	}
+
+	return res
+}
+
+func errorSummary(errorm map[string]int) string {
+	errs := make([]string, 0, len(errorm))
+	for err := range errorm {
+		errs = append(errs, err)
+	}
+	sort.Strings(errs)
+
+	for i, err := range errs {
+		errs[i] = fmt.Sprintf("[%d] %s", errorm[err], err)
+	}
+	return strings.Join(errs, "; ")
+}
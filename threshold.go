@@ -0,0 +1,265 @@
+package spidomtr
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var thresholdRe = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_.\-]*)\s*(<=|>=|==|!=|<|>)\s*(\S+)\s*$`)
+
+// Threshold is a pass/fail criterion on a metric of a result, e.g.
+// "p99 < 200ms" or "error_rate <= 1%". The supported metrics are avg,
+// min, max, pNN (any percentile), count, passed, passed_retried,
+// errors, skips, retries, error_rate and rps.
+//
+// Custom metrics are referred to as "<name>.<aggregate>", e.g.
+// "bytes.total > 1024" or "queue_time.p99 < 1s". Counters have the
+// aggregate total, and gauges, histograms and trends count, sum, avg,
+// min, max, last and pNN. Values of trends are durations.
+type Threshold struct {
+	Expr   string
+	Metric string
+	Op     string
+	Tags   map[string]string
+	TestID string
+	Value  float64
+}
+
+// Violation is a threshold that was not met
+type Violation struct {
+	Observed  float64
+	Threshold Threshold
+}
+
+// ParseThreshold parses a threshold expression of the form
+// "<metric> <op> <value>", where op is one of <, <=, >, >=, == and !=.
+// Values of latency metrics are durations, and values of error_rate
+// may be given in percent.
+func ParseThreshold(expr string) (Threshold, error) {
+	m := thresholdRe.FindStringSubmatch(expr)
+	if m == nil {
+		return Threshold{}, fmt.Errorf("invalid threshold %q", expr)
+	}
+	t := Threshold{Expr: strings.TrimSpace(expr), Metric: m[1], Op: m[2]}
+
+	if !knownMetric(t.Metric) {
+		return Threshold{}, fmt.Errorf("invalid threshold %q: unknown metric %s", expr, t.Metric)
+	}
+
+	var err error
+	switch {
+	case isCustomDuration(t.Metric, m[3]):
+		var d time.Duration
+		d, err = time.ParseDuration(m[3])
+		t.Value = float64(d)
+	case isLatencyMetric(t.Metric):
+		var d time.Duration
+		d, err = time.ParseDuration(m[3])
+		t.Value = float64(d)
+	case strings.HasSuffix(m[3], "%"):
+		t.Value, err = strconv.ParseFloat(strings.TrimSuffix(m[3], "%"), 64)
+		t.Value /= 100
+	default:
+		t.Value, err = strconv.ParseFloat(m[3], 64)
+	}
+	if err != nil {
+		return Threshold{}, fmt.Errorf("invalid threshold %q: %v", expr, err)
+	}
+	return t, nil
+}
+
+// MustParseThreshold is like ParseThreshold but panics if the
+// expression cannot be parsed
+func MustParseThreshold(expr string) Threshold {
+	t, err := ParseThreshold(expr)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// ForTest returns a copy of the threshold applied to the stats of the
+// test with id, instead of the total stats
+func (t Threshold) ForTest(id string) Threshold {
+	t.TestID = id
+	return t
+}
+
+// ForTags returns a copy of the threshold applied to the stats of the
+// test results with all tags, e.g. {"region": "eu"}
+func (t Threshold) ForTags(tags map[string]string) Threshold {
+	t.Tags = tags
+	return t
+}
+
+// Check checks the threshold against res. The observed value is NaN if
+// the threshold applies to a test, or tags, that have no results.
+func (t Threshold) Check(res Result) (float64, bool) {
+	stats := res.Stats
+	if len(t.Tags) > 0 {
+		ts := res.filter(t.TestID, t.Tags)
+		if ts.Stats.Count == 0 {
+			return math.NaN(), false
+		}
+		stats = ts.Stats
+	} else if t.TestID != "" {
+		ts, ok := res.TestStats[t.TestID]
+		if !ok {
+			return math.NaN(), false
+		}
+		stats = ts.Stats
+	}
+
+	v := metricValue(stats, t.Metric)
+	switch t.Op {
+	case "<":
+		return v, v < t.Value
+	case "<=":
+		return v, v <= t.Value
+	case ">":
+		return v, v > t.Value
+	case ">=":
+		return v, v >= t.Value
+	case "==":
+		return v, v == t.Value
+	case "!=":
+		return v, v != t.Value
+	}
+	return v, false
+}
+
+// String returns the threshold expression
+func (t Threshold) String() string {
+	return t.prefix() + t.Expr
+}
+
+// prefix returns the test ID and tags the threshold applies to, e.g.
+// "get{region=eu}: "
+func (t Threshold) prefix() string {
+	if t.TestID == "" && len(t.Tags) == 0 {
+		return ""
+	}
+	return t.TestID + tagsStr(t.Tags) + ": "
+}
+
+// Check checks the thresholds against the result, and returns the ones
+// that were not met
+func (r Result) Check(thresholds ...Threshold) []Violation {
+	var violations []Violation
+	for _, t := range thresholds {
+		if v, ok := t.Check(r); !ok {
+			violations = append(violations, Violation{Observed: v, Threshold: t})
+		}
+	}
+	return violations
+}
+
+// String describes the violation, e.g. "expected p99 < 200ms, observed
+// p99 = 250ms"
+func (v Violation) String() string {
+	prefix := v.Threshold.prefix()
+	if math.IsNaN(v.Observed) {
+		return fmt.Sprintf("%sexpected %s, observed no results", prefix, v.Threshold.Expr)
+	}
+	observed := formatMetric(v.Threshold.Metric, v.Observed)
+	if m := thresholdRe.FindStringSubmatch(v.Threshold.Expr); m != nil && isCustomDuration(m[1], m[3]) {
+		observed = time.Duration(v.Observed).String()
+	}
+	return fmt.Sprintf("%sexpected %s, observed %s = %s", prefix, v.Threshold.Expr, v.Threshold.Metric, observed)
+}
+
+func knownMetric(metric string) bool {
+	switch metric {
+	case "avg", "min", "max", "count", "passed", "passed_retried", "errors", "skips", "retries", "error_rate", "rps":
+		return true
+	}
+	if _, ok := percentileMetric(metric); ok {
+		return true
+	}
+	_, _, ok := customMetric(metric)
+	return ok
+}
+
+// isCustomDuration returns if the value of a custom metric threshold is
+// a duration, i.e. a trend threshold
+func isCustomDuration(metric, value string) bool {
+	if _, _, ok := customMetric(metric); !ok {
+		return false
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return false
+	}
+	_, err := time.ParseDuration(value)
+	return err == nil
+}
+
+func isLatencyMetric(metric string) bool {
+	switch metric {
+	case "avg", "min", "max":
+		return true
+	}
+	_, ok := percentileMetric(metric)
+	return ok
+}
+
+func percentileMetric(metric string) (int, bool) {
+	if !strings.HasPrefix(metric, "p") {
+		return 0, false
+	}
+	p, err := strconv.Atoi(metric[1:])
+	if err != nil || p <= 0 || p > 100 {
+		return 0, false
+	}
+	return p, true
+}
+
+func metricValue(stats Stats, metric string) float64 {
+	switch metric {
+	case "avg":
+		return float64(stats.Average)
+	case "min":
+		return float64(stats.Fastest)
+	case "max":
+		return float64(stats.Slowest)
+	case "count":
+		return float64(stats.Count)
+	case "passed":
+		return float64(stats.Passed)
+	case "passed_retried":
+		return float64(stats.PassedRetried)
+	case "errors":
+		return float64(stats.Errors)
+	case "skips":
+		return float64(stats.Skips)
+	case "retries":
+		return float64(stats.Retries)
+	case "error_rate":
+		if stats.Passed+stats.Errors == 0 {
+			return 0
+		}
+		return float64(stats.Errors) / float64(stats.Passed+stats.Errors)
+	case "rps":
+		return stats.RPS
+	}
+	if p, ok := percentileMetric(metric); ok {
+		return float64(percentile(stats.Durations, p))
+	}
+	if name, agg, ok := customMetric(metric); ok {
+		return customValue(stats, name, agg)
+	}
+	return math.NaN()
+}
+
+func formatMetric(metric string, v float64) string {
+	switch {
+	case isLatencyMetric(metric):
+		return time.Duration(v).String()
+	case metric == "error_rate":
+		return strconv.FormatFloat(v*100, 'f', -1, 64) + "%"
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
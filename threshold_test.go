@@ -0,0 +1,217 @@
+package spidomtr_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spider-pigs/spidomtr"
+	"github.com/spider-pigs/spidomtr/pkg/testunit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseThreshold(t *testing.T) {
+	th, err := spidomtr.ParseThreshold("p99 < 200ms")
+	require.NoError(t, err)
+	require.Equal(t, spidomtr.Threshold{Expr: "p99 < 200ms", Metric: "p99", Op: "<", Value: float64(200 * time.Millisecond)}, th)
+
+	th, err = spidomtr.ParseThreshold("error_rate<=1.5%")
+	require.NoError(t, err)
+	require.Equal(t, "<=", th.Op)
+	require.InDelta(t, 0.015, th.Value, 1e-9)
+
+	th, err = spidomtr.ParseThreshold("rps >= 100")
+	require.NoError(t, err)
+	require.Equal(t, float64(100), th.Value)
+
+	for _, expr := range []string{"p99 < fast", "p101 < 1s", "latency < 1s", "avg ~ 1s", ""} {
+		_, err := spidomtr.ParseThreshold(expr)
+		require.Error(t, err, expr)
+	}
+}
+
+func TestResultCheck(t *testing.T) {
+	res := spidomtr.Result{
+		Stats: spidomtr.Stats{
+			Count:     4,
+			Durations: []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond},
+			Errors:    1,
+			Passed:    3,
+		},
+		TestStats: map[string]spidomtr.TestStats{
+			"test": {Stats: spidomtr.Stats{Average: 50 * time.Millisecond}},
+		},
+	}
+
+	violations := res.Check(
+		spidomtr.MustParseThreshold("p50 <= 20ms"),
+		spidomtr.MustParseThreshold("p99 < 30ms"),
+		spidomtr.MustParseThreshold("error_rate < 10%"),
+		spidomtr.MustParseThreshold("avg < 40ms").ForTest("test"),
+		spidomtr.MustParseThreshold("count > 0").ForTest("missing"),
+	)
+	strs := make([]string, len(violations))
+	for i, v := range violations {
+		strs[i] = v.String()
+	}
+	require.Equal(t, []string{
+		"expected p99 < 30ms, observed p99 = 30ms",
+		"expected error_rate < 10%, observed error_rate = 25%",
+		"test: expected avg < 40ms, observed avg = 50ms",
+		"missing: expected count > 0, observed no results",
+	}, strs)
+}
+
+// fakeTB records failures instead of failing the test
+type fakeTB struct {
+	testing.TB
+	errors []string
+	logs   []string
+}
+
+func (tb *fakeTB) Helper() {}
+
+func (tb *fakeTB) Error(args ...interface{}) {
+	tb.errors = append(tb.errors, fmt.Sprint(args...))
+}
+
+func (tb *fakeTB) Errorf(format string, args ...interface{}) {
+	tb.errors = append(tb.errors, fmt.Sprintf(format, args...))
+}
+
+func (tb *fakeTB) Log(args ...interface{}) {
+	tb.logs = append(tb.logs, fmt.Sprint(args...))
+}
+
+func TestRunT(t *testing.T) {
+	fast := testunit.New(testunit.ID("fast"))
+	slow := testunit.New(
+		testunit.ID("slow"),
+		testunit.Test(func(context.Context, []interface{}) ([]interface{}, error) {
+			time.Sleep(5 * time.Millisecond)
+			return nil, nil
+		}),
+	)
+	failing := testunit.New(
+		testunit.ID("failing"),
+		testunit.Test(func(context.Context, []interface{}) ([]interface{}, error) {
+			return nil, errors.New("whooops")
+		}),
+	)
+
+	t.Run("passing", func(t *testing.T) {
+		runner := spidomtr.NewRunner(
+			spidomtr.Iterations(20),
+			spidomtr.Thresholds(
+				spidomtr.MustParseThreshold("max < 1s").ForTest("fast"),
+				spidomtr.MustParseThreshold("count > 0"),
+			),
+		)
+		res := spidomtr.RunT(t, runner, fast)
+		require.Equal(t, 0, res.Stats.Errors)
+	})
+	t.Run("failing", func(t *testing.T) {
+		runner := spidomtr.NewRunner(
+			spidomtr.Iterations(20),
+			spidomtr.Thresholds(
+				spidomtr.MustParseThreshold("min > 1ms").ForTest("slow"),
+				spidomtr.MustParseThreshold("p90 < 1ms").ForTest("slow"),
+				spidomtr.MustParseThreshold("passed > 100"),
+			),
+		)
+
+		tb := &fakeTB{}
+		res := spidomtr.RunT(tb, runner, fast, slow, failing)
+		require.Equal(t, 20, res.Stats.Errors)
+		require.Len(t, tb.errors, 3)
+		require.True(t, strings.HasPrefix(tb.errors[0], "slow: expected p90 < 1ms, observed p90 = "), tb.errors[0])
+		require.Equal(t, "20/20 failed: [20] whooops", tb.errors[1])
+		require.Equal(t, "expected passed > 100, observed passed = 40", tb.errors[2])
+		require.Len(t, tb.logs, 1)
+		require.Contains(t, tb.logs[0], "Summary:")
+	})
+	t.Run("error thresholds allow errors", func(t *testing.T) {
+		runner := spidomtr.NewRunner(
+			spidomtr.Iterations(20),
+			spidomtr.ShowSummary(false),
+			spidomtr.Thresholds(spidomtr.MustParseThreshold("error_rate <= 50%")),
+		)
+
+		tb := &fakeTB{}
+		spidomtr.RunT(tb, runner, fast, failing)
+		require.Empty(t, tb.errors)
+		require.Empty(t, tb.logs)
+	})
+	t.Run("test error thresholds only allow errors of the test", func(t *testing.T) {
+		flaky := testunit.New(
+			testunit.ID("flaky"),
+			testunit.Test(func(context.Context, []interface{}) ([]interface{}, error) {
+				return nil, errors.New("oops")
+			}),
+		)
+		runner := spidomtr.NewRunner(
+			spidomtr.Iterations(20),
+			spidomtr.ShowSummary(false),
+			spidomtr.Thresholds(spidomtr.MustParseThreshold("errors <= 20").ForTest("flaky")),
+		)
+
+		tb := &fakeTB{}
+		spidomtr.RunT(tb, runner, flaky, failing)
+		require.Equal(t, []string{"20/20 failed: [20] whooops"}, tb.errors)
+	})
+	t.Run("tag error thresholds only allow errors of matching tests", func(t *testing.T) {
+		flaky := testunit.New(
+			testunit.ID("flaky"),
+			testunit.Tags(map[string]string{"region": "eu"}),
+			testunit.Test(func(context.Context, []interface{}) ([]interface{}, error) {
+				return nil, errors.New("oops")
+			}),
+		)
+		runner := spidomtr.NewRunner(
+			spidomtr.Iterations(20),
+			spidomtr.ShowSummary(false),
+			spidomtr.Thresholds(spidomtr.MustParseThreshold("errors <= 20").ForTags(map[string]string{"region": "eu"})),
+		)
+
+		tb := &fakeTB{}
+		spidomtr.RunT(tb, runner, flaky, failing)
+		require.Equal(t, []string{"20/20 failed: [20] whooops"}, tb.errors)
+	})
+	t.Run("thresholds of unknown tests fail", func(t *testing.T) {
+		runner := spidomtr.NewRunner(
+			spidomtr.Iterations(20),
+			spidomtr.ShowSummary(false),
+			spidomtr.Thresholds(spidomtr.MustParseThreshold("max < 1s").ForTest("fsat")),
+		)
+
+		tb := &fakeTB{}
+		spidomtr.RunT(tb, runner, fast)
+		require.Equal(t, []string{"unknown test in threshold fsat: max < 1s"}, tb.errors)
+	})
+}
+
+func TestPercentiles(t *testing.T) {
+	runner := spidomtr.NewRunner(
+		spidomtr.Iterations(10),
+		spidomtr.ShowLogo(false),
+		spidomtr.ShowSummary(false),
+	)
+	res := runner.Run(context.Background(), testunit.New(
+		testunit.Test(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			time.Sleep(time.Duration(testunit.Iteration(ctx)) * time.Millisecond)
+			return args, nil
+		}),
+	))
+
+	// The summary, thresholds and Percentile agree on the percentiles
+	require.Len(t, res.Stats.Distributions, len(spidomtr.DefaultPercentiles))
+	for _, d := range res.Stats.Distributions {
+		require.Equal(t, res.Stats.Percentile(d.Percentage), d.Latency, d.Percentage)
+		v, _ := spidomtr.MustParseThreshold(fmt.Sprintf("p%d < 1s", d.Percentage)).Check(res)
+		require.Equal(t, float64(d.Latency), v, d.Percentage)
+	}
+	require.Equal(t, res.Stats.Slowest, res.Stats.Percentile(99))
+}